@@ -29,6 +29,27 @@ func NewFrustum(fovX, fovY, znear, zfar float64) Frustum {
 	}
 }
 
+// NewOrthoFrustum returns the box an orthographic projection shows. It is
+// width by height and centered on the view direction.
+func NewOrthoFrustum(width, height, znear, zfar float64) Frustum {
+	return Frustum{
+		planes: []Plane{
+			// Left Plane
+			{point: Vec3{-width / 2, 0, 0}, normal: Vec3{1, 0, 0}},
+			// Right Plane
+			{point: Vec3{width / 2, 0, 0}, normal: Vec3{-1, 0, 0}},
+			// Top Plane
+			{point: Vec3{0, height / 2, 0}, normal: Vec3{0, -1, 0}},
+			// Bottom Plane
+			{point: Vec3{0, -height / 2, 0}, normal: Vec3{0, 1, 0}},
+			// Near Plane
+			{point: Vec3{0, 0, znear}, normal: Vec3{0, 0, 1}},
+			// Far Plane
+			{point: Vec3{0, 0, zfar}, normal: Vec3{0, 0, -1}},
+		},
+	}
+}
+
 // Frustum is typically a 6 plane (front, back, right, left, top, bottom) geometry.
 type Frustum struct {
 	planes []Plane
@@ -0,0 +1,71 @@
+package heretic
+
+import (
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Clock is where the engine gets the time from. Now is the time since some
+// fixed point, like when the clock was created.
+type Clock interface {
+	Now() time.Duration
+	Sleep(d time.Duration)
+}
+
+// SDLClock uses SDL's millisecond ticks. It is the default clock of the
+// engine.
+type SDLClock struct{}
+
+func (SDLClock) Now() time.Duration {
+	return time.Duration(sdl.GetTicks()) * time.Millisecond
+}
+
+func (SDLClock) Sleep(d time.Duration) {
+	sdl.Delay(uint32(d / time.Millisecond))
+}
+
+// RealClock uses the time package, so it works without SDL.
+type RealClock struct {
+	start time.Time
+}
+
+// NewRealClock returns a clock that starts at zero now.
+func NewRealClock() RealClock {
+	return RealClock{start: time.Now()}
+}
+
+func (c RealClock) Now() time.Duration {
+	return time.Since(c.start)
+}
+
+func (RealClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// FakeClock only moves when told to. Sleeping moves it forward instead of
+// waiting, so an engine with a FakeClock runs at exactly the target frame rate
+// no matter how long frames take, and each frame is reproducible.
+type FakeClock struct {
+	now time.Duration
+}
+
+// NewFakeClock returns a clock that starts at zero.
+func NewFakeClock() *FakeClock {
+	return &FakeClock{}
+}
+
+func (c *FakeClock) Now() time.Duration {
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Advance moves the clock forward.
+func (c *FakeClock) Advance(d time.Duration) {
+	if d > 0 {
+		c.now += d
+	}
+}
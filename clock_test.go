@@ -0,0 +1,101 @@
+package heretic
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newClockTestEngine(clock Clock) (*Engine, *Offscreen) {
+	offscreen := NewOffscreen(64, 64)
+	engine := NewEngine(offscreen, NewFramebuffer(64, 64))
+	engine.SetClock(clock)
+	engine.SetMesh(NewMeshFromObj(filepath.Join("assets", "cube.obj")))
+	engine.SetAutoRotation(Vec3{Y: 1})
+	engine.Setup()
+	return engine, offscreen
+}
+
+func TestFixedTimestep(t *testing.T) {
+	engine, _ := newClockTestEngine(NewFakeClock())
+	mesh := engine.scene.Meshes[0]
+	step := Timestep.Seconds()
+
+	// Less than a step only moves the interpolation.
+	engine.Advance(Timestep / 2)
+	if mesh.Rotation.Y != 0 {
+		t.Errorf("rotation after half a step = %v, want 0", mesh.Rotation.Y)
+	}
+	if engine.accumulator != Timestep/2 {
+		t.Errorf("accumulator = %v, want %v", engine.accumulator, Timestep/2)
+	}
+
+	// The remainder is carried over.
+	engine.Advance(Timestep*2 + Timestep/2)
+	if got, want := mesh.Rotation.Y, 3*step; math.Abs(got-want) > 1e-9 {
+		t.Errorf("rotation after three steps = %v, want %v", got, want)
+	}
+	if got, want := mesh.previousRotation.Y, 2*step; math.Abs(got-want) > 1e-9 {
+		t.Errorf("previous rotation = %v, want %v", got, want)
+	}
+}
+
+// TestAdvanceLongFrames turns a full circle in four frames of half a second,
+// like a turntable with a delay of 50.
+func TestAdvanceLongFrames(t *testing.T) {
+	engine, _ := newClockTestEngine(NewFakeClock())
+	mesh := engine.scene.Meshes[0]
+
+	frameTime := 500 * time.Millisecond
+	engine.SetAutoRotation(Vec3{Y: 2 * math.Pi / 4 / frameTime.Seconds()})
+	for i := 0; i < 4; i++ {
+		engine.Advance(frameTime)
+	}
+	// Timestep is rounded down to whole nanoseconds, so a few nanoseconds
+	// are still in the accumulator.
+	if got, want := mesh.Rotation.Y, 2*math.Pi; math.Abs(got-want) > 1e-6 {
+		t.Errorf("rotation after four long frames = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateClampsLongFrames(t *testing.T) {
+	clock := NewFakeClock()
+	engine, _ := newClockTestEngine(clock)
+	mesh := engine.scene.Meshes[0]
+
+	clock.Advance(time.Hour)
+	engine.Update()
+	if got, max := mesh.Rotation.Y, maxFrameTime.Seconds(); got > max+1e-9 {
+		t.Errorf("rotation after a long frame = %v, want at most %v", got, max)
+	}
+}
+
+func TestFakeClockDeterministic(t *testing.T) {
+	render := func() ([]byte, float64, time.Duration) {
+		clock := NewFakeClock()
+		engine, offscreen := newClockTestEngine(clock)
+		for i := 0; i < 100; i++ {
+			engine.Update()
+			engine.Render()
+		}
+		return offscreen.Image().Pix, engine.scene.Meshes[0].Rotation.Y, clock.Now()
+	}
+
+	a, rotation, now := render()
+	b, _, _ := render()
+	if !bytes.Equal(a, b) {
+		t.Error("frames differ between runs with a fake clock")
+	}
+
+	// The fake clock sleeps for every frame, so it is exactly 100 frames
+	// later and the rotation is every whole step in that time.
+	if want := 100 * time.Duration(TargetFrameTime) * time.Millisecond; now != want {
+		t.Errorf("clock = %v, want %v", now, want)
+	}
+	steps := int(now / Timestep)
+	if want := float64(steps) * Timestep.Seconds(); math.Abs(rotation-want) > 1e-9 {
+		t.Errorf("rotation = %v, want %v (%d steps)", rotation, want, steps)
+	}
+}
@@ -0,0 +1,45 @@
+// fftinspect dumps the GNS records and mesh structure of a map.
+//
+//	fftinspect -iso fft.bin -map 1
+//	fftinspect -iso fft.bin -map 1 -json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/adamrt/heretic/fft"
+)
+
+func main() {
+	isoFile := flag.String("iso", "", "ISO or BIN image")
+	mapNum := flag.Int("map", -1, "map number")
+	asJSON := flag.Bool("json", false, "write JSON instead of text")
+	flag.Parse()
+
+	if *isoFile == "" || *mapNum < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	iso := fft.NewISOReader(*isoFile)
+	defer iso.Close()
+
+	ins, err := fft.NewMeshReader(iso).Inspect(*mapNum)
+	if err != nil {
+		log.Fatalf("inspect map %d: %v", *mapNum, err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(ins)
+	} else {
+		err = ins.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
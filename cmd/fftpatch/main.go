@@ -0,0 +1,123 @@
+// fftpatch writes modified map files into a copy of an FFT disc image.
+//
+// The mesh and texture files are in the format the game uses, as produced by
+// fft.EncodeMesh and fft.EncodeTexture. The original image is never changed,
+// and the patched image is only written if every file could be patched.
+//
+//	fftpatch -in fft.bin -out patched.bin -map 1 -mesh map001.mesh -texture map001.tex
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/adamrt/heretic/fft"
+)
+
+func main() {
+	in := flag.String("in", "", "original ISO or BIN image")
+	out := flag.String("out", "", "patched image to write")
+	mapNum := flag.Int("map", -1, "map number")
+	meshFile := flag.String("mesh", "", "encoded mesh to write over the map's mesh record")
+	textureFile := flag.String("texture", "", "encoded texture to write over the map's texture record")
+	night := flag.Bool("night", false, "patch the night records")
+	weather := flag.Int("weather", int(fft.WeatherNone), "weather of the records to patch (0-4)")
+	flag.Parse()
+
+	if *in == "" || *out == "" || *mapNum < 0 || (*meshFile == "" && *textureFile == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *weather < int(fft.WeatherNone) || *weather > int(fft.WeatherVeryStrong) {
+		log.Fatalf("weather %d is out of range, expected 0-4", *weather)
+	}
+
+	state := fft.MapState{Time: fft.TimeDay, Weather: fft.MapWeather(*weather)}
+	if *night {
+		state.Time = fft.TimeNight
+	}
+
+	if err := patch(*in, *out, *mapNum, state, *meshFile, *textureFile); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// patch copies the image and writes the mesh and texture files into the copy.
+// The copy is a temporary file next to out, which is renamed to out once
+// everything is patched. A half written image is worse than none, so on
+// errors the temporary file is removed and out is left as it was.
+func patch(in, out string, mapNum int, state fft.MapState, meshFile, textureFile string) error {
+	inInfo, err := os.Stat(in)
+	if err != nil {
+		return err
+	}
+	if outInfo, err := os.Stat(out); err == nil && os.SameFile(inInfo, outInfo) {
+		return fmt.Errorf("%s and %s are the same file, the original image is never changed", in, out)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*")
+	if err != nil {
+		return err
+	}
+	renamed := false
+	defer func() {
+		if !renamed {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err := f.Chmod(inInfo.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := copyFile(in, f); err != nil {
+		return fmt.Errorf("copy image: %w", err)
+	}
+
+	patcher, err := fft.NewDiscPatcher(f)
+	if err != nil {
+		return fmt.Errorf("open image %s: %w", in, err)
+	}
+	if meshFile != "" {
+		data, err := os.ReadFile(meshFile)
+		if err != nil {
+			return err
+		}
+		// Meshes are checked not to lose any section of the mesh on
+		// the disc, like PatchMap does.
+		if err := patcher.PatchMesh(mapNum, state, data); err != nil {
+			return fmt.Errorf("patch %s: %w", meshFile, err)
+		}
+	}
+	if textureFile != "" {
+		data, err := os.ReadFile(textureFile)
+		if err != nil {
+			return err
+		}
+		if err := patcher.PatchRecord(mapNum, fft.RecordTypeTexture, state, data); err != nil {
+			return fmt.Errorf("patch %s: %w", textureFile, err)
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), out); err != nil {
+		return err
+	}
+	renamed = true
+	return nil
+}
+
+func copyFile(src string, dst io.Writer) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(dst, in)
+	return err
+}
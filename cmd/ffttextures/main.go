@@ -0,0 +1,96 @@
+// ffttextures exports the texture of a map through each of its palettes.
+//
+// By default every color and gray palette gets its own PNG. With -sheet they
+// are combined into a single PNG, color palettes on the first row and gray
+// palettes on the second.
+//
+//	ffttextures -iso fft.bin -map 1 -out textures/
+//	ffttextures -iso fft.bin -map 1 -out textures/ -sheet
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/adamrt/heretic"
+	"github.com/adamrt/heretic/fft"
+)
+
+func main() {
+	isoFile := flag.String("iso", "", "ISO or BIN image")
+	mapNum := flag.Int("map", -1, "map number")
+	night := flag.Bool("night", false, "use the night records")
+	weather := flag.Int("weather", int(fft.WeatherNone), "weather of the records to use (0-4)")
+	out := flag.String("out", ".", "directory to write the PNGs to")
+	sheet := flag.Bool("sheet", false, "write a single contact sheet instead of a PNG per palette")
+	flag.Parse()
+
+	if *isoFile == "" || *mapNum < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	state := fft.MapState{Time: fft.TimeDay, Weather: fft.MapWeather(*weather)}
+	if *night {
+		state.Time = fft.TimeNight
+	}
+
+	iso := fft.NewISOReader(*isoFile)
+	defer iso.Close()
+
+	m, err := fft.NewMeshReader(iso).ReadMapRaw(*mapNum, state)
+	if err != nil {
+		log.Fatalf("read map %d: %v", *mapNum, err)
+	}
+	texture, ok := m.Texture()
+	if !ok {
+		log.Fatalf("map %d has no texture", *mapNum)
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	prefix := fmt.Sprintf("MAP%03d", *mapNum)
+	if *sheet {
+		// Maps without gray palettes would get an empty row.
+		sets := [][]heretic.Palette{m.Palettes}
+		if len(m.GrayPalettes) > 0 {
+			sets = append(sets, m.GrayPalettes)
+		}
+		img := fft.TextureSheet(texture, sets...)
+		writePNG(filepath.Join(*out, prefix+"_textures.png"), img)
+		return
+	}
+
+	sets := []struct {
+		name     string
+		palettes []heretic.Palette
+	}{
+		{"color", m.Palettes},
+		{"gray", m.GrayPalettes},
+	}
+	for _, set := range sets {
+		for i, palette := range set.palettes {
+			img := fft.TextureImage(texture, palette)
+			writePNG(filepath.Join(*out, fmt.Sprintf("%s_%s_%02d.png", prefix, set.name, i)), img)
+		}
+	}
+}
+
+func writePNG(path string, img image.Image) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		log.Fatalf("write %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,33 +1,619 @@
+// heretic views FFT maps and OBJ files.
+//
+//	heretic view [flags] fft.bin
+//	heretic view [flags] assets/f22.obj
+//	heretic replay [flags] -recording session.jsonl
+//	heretic render [flags] -out map.png fft.bin
+//	heretic render -width 1920 -height 1080 -eye 0,2,-2 -ortho 2.5 -out f22.png assets/f22.obj
+//	heretic turntable [flags] -frames 36 -out f22.gif assets/f22.obj
+//	heretic sheet [flags] -out sheet/ fft.bin
+//	heretic info [-map n] [-json] fft.bin
+//	heretic export -map n -out dir fft.bin
+//	heretic export -all -out dir fft.bin
+//
+// Files ending in .obj are loaded as OBJ files, anything else as an FFT ISO or
+// BIN image. Run a command with -h for its flags.
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/adamrt/heretic"
 	"github.com/adamrt/heretic/fft"
 )
 
-const (
-	WindowWidth  = 800
-	WindowHeight = 800
-)
+const usage = `usage: heretic <command> [flags] <file>
+
+commands:
+  view       open a window to view an FFT map or OBJ file
+  replay     play back a recording of view and write the last frame to a PNG
+  render     render a single frame of an FFT map or OBJ file to a PNG without
+             opening a window
+  turntable  render an FFT map or OBJ file turning around to an animated GIF
+  sheet      render a thumbnail of every FFT map into a contact sheet and
+             an HTML index
+  info       list the maps of an FFT image, or inspect one
+  export     export an FFT map, or all of them, as OBJ files with their
+             textures
+`
 
 func main() {
-	fb := heretic.NewFramebuffer(WindowWidth, WindowHeight)
-	window := heretic.NewWindow(WindowWidth, WindowHeight)
-	defer window.Destroy()
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
 
-	engine := heretic.NewEngine(window, fb)
-	// engine.LoadMesh("assets/f22.obj")
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "view":
+		view(args)
+	case "render":
+		render(args)
+	case "replay":
+		replay(args)
+	case "turntable":
+		turntable(args)
+	case "sheet":
+		sheet(args)
+	case "info":
+		info(args)
+	case "export":
+		export(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
 
-	iso := fft.NewISOReader("/home/adam/tmp/emu/fft.iso")
-	defer iso.Close()
+// cameraFlags are the flags that set up the engine and its camera.
+type cameraFlags struct {
+	width, height int
+	fov           float64
+	ortho         float64
+	renderMode    string
+	wireMode      string
+	cullMode      string
+	eye           vec3Flag
+	target        vec3Flag
+	up            vec3Flag
+}
+
+func newCameraFlags(fs *flag.FlagSet, width, height int) *cameraFlags {
+	f := &cameraFlags{
+		eye:    vec3Flag{X: -1, Y: 1, Z: -1},
+		target: vec3Flag{},
+		up:     vec3Flag{Y: 1},
+	}
+	fs.IntVar(&f.width, "width", width, "width in pixels")
+	fs.IntVar(&f.height, "height", height, "height in pixels")
+	fs.Float64Var(&f.fov, "fov", 60, "vertical field of view in degrees")
+	fs.Float64Var(&f.ortho, "ortho", 0, "use an orthographic projection this many units high instead of -fov")
+	fs.StringVar(&f.renderMode, "render", "texture", "render mode: texture, fill or none")
+	fs.StringVar(&f.wireMode, "wire", "off", "wire mode: off or on")
+	fs.StringVar(&f.cullMode, "cull", "back", "cull mode: none or back")
+	fs.Var(&f.eye, "eye", "camera position as x,y,z")
+	fs.Var(&f.target, "target", "point the camera looks at as x,y,z")
+	fs.Var(&f.up, "up", "camera up direction as x,y,z")
+	return f
+}
+
+// newEngine creates an engine with the display, set up from the flags. The
+// display is created with the size from the flags.
+func (f *cameraFlags) newEngine(newDisplay func(width, height int) heretic.Display) (*heretic.Engine, heretic.Display) {
+	renderMode, err := heretic.ParseRenderMode(f.renderMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	wireMode, err := heretic.ParseWireMode(f.wireMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cullMode, err := heretic.ParseCullMode(f.cullMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if f.width <= 0 || f.height <= 0 {
+		log.Fatalf("invalid size %dx%d", f.width, f.height)
+	}
+
+	fb := heretic.NewFramebuffer(f.width, f.height)
+	display := newDisplay(f.width, f.height)
+	engine := heretic.NewEngine(display, fb)
+	if f.ortho > 0 {
+		engine.SetOrthographic(f.ortho)
+	} else {
+		engine.SetFOV(f.fov * math.Pi / 180)
+	}
+	engine.SetRenderMode(renderMode)
+	engine.SetWireMode(wireMode)
+	engine.SetCullMode(cullMode)
+	engine.SetCamera(heretic.Vec3(f.eye), heretic.Vec3(f.target), heretic.Vec3(f.up))
+	return engine, display
+}
+
+// newOffscreenEngine is newEngine without a window.
+func (f *cameraFlags) newOffscreenEngine() (*heretic.Engine, *heretic.Offscreen) {
+	engine, display := f.newEngine(func(width, height int) heretic.Display {
+		return heretic.NewOffscreen(width, height)
+	})
+	return engine, display.(*heretic.Offscreen)
+}
+
+// stateFlags choose the time/weather state of FFT maps.
+type stateFlags struct {
+	night   bool
+	weather int
+}
+
+func newStateFlags(fs *flag.FlagSet) *stateFlags {
+	f := &stateFlags{}
+	fs.BoolVar(&f.night, "night", false, "use the night state of the map")
+	fs.IntVar(&f.weather, "weather", int(fft.WeatherNone), "weather of the state to use (0-4)")
+	return f
+}
+
+func (f *stateFlags) state() fft.MapState {
+	state := fft.MapState{Time: fft.TimeDay, Weather: fft.MapWeather(f.weather)}
+	if f.night {
+		state.Time = fft.TimeNight
+	}
+	return state
+}
+
+// sceneFlags are the flags shared by the commands that show a single FFT map
+// or OBJ file.
+type sceneFlags struct {
+	*cameraFlags
+	*stateFlags
+	mapNum int
+	tile   tileFlag
+}
+
+func newSceneFlags(fs *flag.FlagSet) *sceneFlags {
+	f := &sceneFlags{
+		cameraFlags: newCameraFlags(fs, 800, 800),
+		stateFlags:  newStateFlags(fs),
+	}
+	fs.IntVar(&f.mapNum, "map", -1, "FFT map to start on (default the first)")
+	fs.Var(&f.tile, "tile", "outline the polygons on the terrain tile `x,z[,level]`")
+	return f
+}
 
-	engine.MeshReader = fft.NewMeshReader(iso)
-	engine.NextMap()
+// load loads the file into the engine. The returned function closes the
+// file, if it is still open.
+func (f *sceneFlags) load(engine *heretic.Engine, filename string) func() {
+	engine.SelectTile(f.tile.loc)
+	if isObj(filename) {
+		engine.SetMesh(heretic.NewMeshFromObj(filename))
+		engine.Setup()
+		return func() {}
+	}
+
+	iso := fft.NewISOReader(filename)
+	catalog := fft.NewCatalog(fft.NewMeshReader(iso))
+	engine.MeshReader = catalog
+	if f.mapNum < 0 {
+		engine.NextMap()
+	} else {
+		engine.LoadMap(f.mapNum, f.stateIndex(catalog))
+	}
+	return func() { iso.Close() }
+}
+
+// stateIndex returns the index of the -night and -weather state in the states
+// of the -map map. It exits if the map isn't in the catalog.
+func (f *sceneFlags) stateIndex(catalog fft.Catalog) int {
+	info, ok := catalog.Map(f.mapNum)
+	if !ok {
+		if err := catalog.Err(f.mapNum); err != nil {
+			log.Fatalf("map %d: %v", f.mapNum, err)
+		}
+		log.Fatalf("map %d doesn't exist", f.mapNum)
+	}
+	state := f.state()
+	for i, s := range info.States {
+		if s == state {
+			return i
+		}
+	}
+	log.Fatalf("map %d has no %s state", f.mapNum, state)
+	return 0
+}
+
+func view(args []string) {
+	fs := flag.NewFlagSet("view", flag.ExitOnError)
+	f := newSceneFlags(fs)
+	bindings := fs.String("bindings", "", "JSON file of key and mouse bindings to use instead of the defaults")
+	record := fs.String("record", "", "file to record the actions of the session to, for replay")
+	filename := parseFile(fs, args)
+
+	engine, window := f.newEngine(func(width, height int) heretic.Display {
+		return heretic.NewWindow(width, height)
+	})
+	defer window.Destroy()
+	if *bindings != "" {
+		b, err := heretic.LoadBindings(*bindings)
+		if err != nil {
+			log.Fatal(err)
+		}
+		engine.SetBindings(b)
+	}
+	defer f.load(engine, filename)()
+
+	if *record != "" {
+		w, err := os.Create(*record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		engine.Record(w, filename)
+		defer func() {
+			if err := engine.StopRecording(); err != nil {
+				log.Fatalf("record %s: %v", *record, err)
+			}
+			if err := w.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
 
-	engine.Setup()
 	for engine.IsRunning {
 		engine.ProcessInput()
 		engine.Update()
 		engine.Render()
 	}
 }
+
+// replay plays back a recording of view. The recording starts with the scene
+// it was recorded in, so only the file can be given, in case it moved. The
+// frames are timed by the recording, so they are the same each time, and the
+// last one is written to a PNG.
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	recording := fs.String("recording", "", "file recorded by view -record")
+	headless := fs.Bool("headless", false, "replay as fast as possible without opening a window")
+	out := fs.String("out", "replay.png", "PNG file to write the last frame to")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: heretic replay [flags] [file]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *recording == "" || fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, err := os.Open(*recording)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rec, err := heretic.ReadRecording(r)
+	r.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	filename := rec.Header.File
+	if fs.NArg() == 1 {
+		filename = fs.Arg(0)
+	}
+	width, height := rec.Header.Width, rec.Header.Height
+	if width <= 0 || height <= 0 {
+		log.Fatalf("replay: invalid size %dx%d in %s", width, height, *recording)
+	}
+
+	var display heretic.Display
+	if *headless {
+		display = heretic.NewOffscreen(width, height)
+	} else {
+		display = heretic.NewWindow(width, height)
+	}
+	defer display.Destroy()
+	engine := heretic.NewEngine(display, heretic.NewFramebuffer(width, height))
+	clock := heretic.NewFakeClock()
+	engine.SetClock(clock)
+	if isObj(filename) {
+		engine.SetMesh(heretic.NewMeshFromObj(filename))
+	} else {
+		iso := fft.NewISOReader(filename)
+		defer iso.Close()
+		engine.MeshReader = fft.NewCatalog(fft.NewMeshReader(iso))
+	}
+
+	// The window shows the frames at the pace they were recorded.
+	start := time.Now()
+	playback := heretic.NewReplay(rec, engine, clock)
+	frames := 0
+	for playback.NextFrame(engine) {
+		engine.Update()
+		engine.Render()
+		frames++
+		if !*headless {
+			time.Sleep(clock.Now() - time.Since(start))
+		}
+	}
+	writePNG(*out, engine.Image())
+	log.Printf("replayed %d frames", frames)
+}
+
+func render(args []string) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	f := newSceneFlags(fs)
+	out := fs.String("out", "heretic.png", "PNG file to write")
+	filename := parseFile(fs, args)
+
+	// Nothing is shown, so render works without a screen.
+	engine, offscreen := f.newOffscreenEngine()
+	defer f.load(engine, filename)()
+
+	// Advance(0) projects the scene without waiting for a frame or
+	// moving it, so the image doesn't depend on the clock.
+	engine.Advance(0)
+	engine.Render()
+	writePNG(*out, offscreen.Image())
+}
+
+func turntable(args []string) {
+	fs := flag.NewFlagSet("turntable", flag.ExitOnError)
+	f := newSceneFlags(fs)
+	frames := fs.Int("frames", 36, "number of frames in a full turn")
+	delay := fs.Int("delay", 4, "time between frames in 100ths of a second")
+	orbit := fs.Bool("orbit", false, "orbit the camera around the target instead of rotating the mesh")
+	out := fs.String("out", "heretic.gif", "GIF file to write")
+	filename := parseFile(fs, args)
+	if *frames <= 0 || *delay <= 0 {
+		log.Fatal("turntable: -frames and -delay must be positive")
+	}
+
+	engine, offscreen := f.newOffscreenEngine()
+	defer f.load(engine, filename)()
+
+	// Each frame turns 1/frames of a circle. Auto rotation is in radians per
+	// second, so it is scaled by the time between frames.
+	step := 2 * math.Pi / float64(*frames)
+	frameTime := time.Duration(*delay) * 10 * time.Millisecond
+	if !*orbit {
+		engine.SetAutoRotation(heretic.Vec3{Y: step / frameTime.Seconds()})
+	}
+
+	images := make([]*image.NRGBA, 0, *frames)
+	for i := 0; i < *frames; i++ {
+		engine.Advance(frameTime)
+		engine.Render()
+		images = append(images, offscreen.Image())
+		if *orbit {
+			// The mouse turns the camera a quarter of xrel*delta.
+			engine.Camera().ProcessMouseMovement(4*step, 0, 1)
+		}
+	}
+
+	w, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := heretic.WriteGIF(w, images, *delay); err != nil {
+		log.Fatalf("write %s: %v", *out, err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func info(args []string) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	mapNum := fs.Int("map", -1, "inspect the records and mesh structure of the map")
+	asJSON := fs.Bool("json", false, "write JSON instead of text")
+	filename := parseFile(fs, args)
+
+	iso := fft.NewISOReader(filename)
+	defer iso.Close()
+	reader := fft.NewMeshReader(iso)
+
+	var v interface{}
+	if *mapNum >= 0 {
+		ins, err := reader.Inspect(*mapNum)
+		if err != nil {
+			log.Fatalf("inspect map %d: %v", *mapNum, err)
+		}
+		if !*asJSON {
+			if err := ins.WriteText(os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		v = ins
+	} else {
+		maps := fft.NewCatalog(reader).Maps()
+		if !*asJSON {
+			fmt.Printf("%-4s %-40s %6s %9s\n", "map", "name", "states", "triangles")
+			for _, m := range maps {
+				fmt.Printf("%-4d %-40s %6d %9d\n", m.Num, m.Name, len(m.States), m.Polygons.Triangles())
+			}
+			return
+		}
+		v = maps
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	mapNum := fs.Int("map", -1, "map number")
+	all := fs.Bool("all", false, "export every map in the catalog instead of -map")
+	workers := fs.Int("workers", 0, "number of maps to read at once with -all (default the number of CPUs)")
+	states := newStateFlags(fs)
+	out := fs.String("out", ".", "directory to write MAPnnn.obj and MAPnnn.png to")
+	filename := parseFile(fs, args)
+	if *all == (*mapNum >= 0) {
+		log.Fatal("export: one of -map or -all is required")
+	}
+	state := states.state()
+
+	iso := fft.NewISOReader(filename)
+	defer iso.Close()
+	reader := fft.NewMeshReader(iso)
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	if !*all {
+		m, err := reader.ReadMap(*mapNum, state)
+		if err != nil {
+			log.Fatalf("read map %d: %v", *mapNum, err)
+		}
+		if err := exportMap(*out, *mapNum, m); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Ctrl-C stops reading maps, the ones already written are kept.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	failed := 0
+	opts := fft.BatchOptions{Workers: *workers, State: state}
+	err := reader.LoadMaps(ctx, fft.NewCatalog(reader).MapNums(), opts, func(result fft.BatchResult, done, total int) {
+		err := result.Err
+		if err == nil {
+			err = exportMap(*out, result.MapNum, result.Map)
+		}
+		if err != nil {
+			log.Printf("map %d: %v", result.MapNum, err)
+			failed++
+			return
+		}
+		log.Printf("%d/%d MAP%03d", done, total, result.MapNum)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if failed > 0 {
+		log.Fatalf("export: %d maps failed", failed)
+	}
+}
+
+// exportMap writes the map to MAPnnn.obj in the directory, and its texture to
+// MAPnnn.png if it has one.
+func exportMap(dir string, mapNum int, m fft.Map) error {
+	base := filepath.Join(dir, fmt.Sprintf("MAP%03d", mapNum))
+	f, err := os.Create(base + ".obj")
+	if err != nil {
+		return err
+	}
+	if err := fft.WriteObj(f, m); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s.obj: %w", base, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if img, ok := fft.ObjTexture(m); ok {
+		writePNG(base+".png", img)
+	}
+	return nil
+}
+
+// parseFile parses the flags and returns the single file argument.
+func parseFile(fs *flag.FlagSet, args []string) string {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: heretic %s [flags] <file>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return fs.Arg(0)
+}
+
+func isObj(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".obj")
+}
+
+func writePNG(path string, img image.Image) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		log.Fatalf("write %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// vec3Flag is a flag for a vector written as x,y,z.
+// tileFlag is a terrain tile location. It is nil until it is set.
+type tileFlag struct {
+	loc *heretic.TileLocation
+}
+
+func (t *tileFlag) String() string {
+	if t.loc == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d,%d,%d", t.loc.X, t.loc.Z, t.loc.Level)
+}
+
+func (t *tileFlag) Set(s string) error {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 && len(parts) != 3 {
+		return fmt.Errorf("expected x,z or x,z,level, got %q", s)
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return err
+		}
+		v[i] = n
+	}
+	t.loc = &heretic.TileLocation{X: v[0], Z: v[1], Level: v[2]}
+	return nil
+}
+
+type vec3Flag heretic.Vec3
+
+func (v *vec3Flag) String() string {
+	return fmt.Sprintf("%g,%g,%g", v.X, v.Y, v.Z)
+}
+
+func (v *vec3Flag) Set(s string) error {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return fmt.Errorf("expected x,y,z, got %q", s)
+	}
+	var xyz [3]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return err
+		}
+		xyz[i] = f
+	}
+	*v = vec3Flag{X: xyz[0], Y: xyz[1], Z: xyz[2]}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/adamrt/heretic"
+	"github.com/adamrt/heretic/fft"
+)
+
+// Thumbnails are labeled below with the map number, at labelScale times the
+// size of the font.
+const (
+	labelScale  = 2
+	labelHeight = (glyphHeight + 2) * labelScale
+)
+
+// thumbnail is a rendered map and where its PNG was written.
+type thumbnail struct {
+	Info  fft.MapInfo
+	File  string
+	image *image.NRGBA
+}
+
+// sheet renders every map of the catalog into a directory of thumbnails, a
+// contact sheet of all of them and an HTML index.
+func sheet(args []string) {
+	fs := flag.NewFlagSet("sheet", flag.ExitOnError)
+	camera := newCameraFlags(fs, 160, 160)
+	states := newStateFlags(fs)
+	cols := fs.Int("cols", 8, "number of thumbnails in each row of the contact sheet")
+	workers := fs.Int("workers", 0, "number of maps to read at once (default the number of CPUs)")
+	out := fs.String("out", "sheet", "directory to write the thumbnails, sheet.png and index.html to")
+	filename := parseFile(fs, args)
+	if *cols <= 0 {
+		log.Fatal("sheet: -cols must be positive")
+	}
+
+	iso := fft.NewISOReader(filename)
+	defer iso.Close()
+	reader := fft.NewMeshReader(iso)
+	catalog := fft.NewCatalog(reader)
+
+	if err := os.MkdirAll(filepath.Join(*out, "maps"), 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	// Maps are read in parallel, but rendered one at a time by the single
+	// engine as they arrive.
+	engine, offscreen := camera.newOffscreenEngine()
+	var thumbs []thumbnail
+	opts := fft.BatchOptions{Workers: *workers, State: states.state()}
+	err := reader.LoadMaps(context.Background(), catalog.MapNums(), opts, func(result fft.BatchResult, done, total int) {
+		if result.Err != nil {
+			log.Printf("map %d: %v", result.MapNum, result.Err)
+			return
+		}
+		engine.SetMesh(result.Map.Mesh)
+		engine.Setup()
+		engine.Advance(0)
+		engine.Render()
+
+		info, _ := catalog.Map(result.MapNum)
+		thumb := thumbnail{
+			Info:  info,
+			File:  fmt.Sprintf("maps/MAP%03d.png", result.MapNum),
+			image: offscreen.Image(),
+		}
+		writePNG(filepath.Join(*out, thumb.File), thumb.image)
+		thumbs = append(thumbs, thumb)
+		log.Printf("%d/%d MAP%03d", done, total, result.MapNum)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Slice(thumbs, func(i, j int) bool { return thumbs[i].Info.Num < thumbs[j].Info.Num })
+
+	writePNG(filepath.Join(*out, "sheet.png"), contactSheet(thumbs, *cols, camera.width, camera.height))
+	writeIndex(filepath.Join(*out, "index.html"), thumbs)
+}
+
+// contactSheet draws the thumbnails in a grid, each labeled with its map
+// number.
+func contactSheet(thumbs []thumbnail, cols, width, height int) *image.NRGBA {
+	if len(thumbs) < cols {
+		cols = len(thumbs)
+	}
+	rows := (len(thumbs) + cols - 1) / cols
+	cellHeight := height + labelHeight
+
+	img := image.NewNRGBA(image.Rect(0, 0, cols*width, rows*cellHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(heretic.ColorBlack), image.Point{}, draw.Src)
+	for i, thumb := range thumbs {
+		at := image.Pt(i%cols*width, i/cols*cellHeight)
+		draw.Draw(img, image.Rectangle{at, at.Add(image.Pt(width, height))}, thumb.image, image.Point{}, draw.Src)
+		label := fmt.Sprintf("MAP%03d", thumb.Info.Num)
+		drawText(img, at.X+labelScale, at.Y+height+labelScale, label, heretic.ColorWhite, labelScale)
+	}
+	return img
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Maps</title>
+<style>
+body { background: #111; color: #ddd; font-family: sans-serif; }
+figure { display: inline-block; margin: 8px; vertical-align: top; width: min-content; }
+figcaption { font-size: small; }
+</style>
+</head>
+<body>
+<p><a href="sheet.png">Contact sheet</a></p>
+{{range .}}<figure>
+<a href="{{.File}}"><img src="{{.File}}" alt="MAP{{printf "%03d" .Info.Num}}"></a>
+<figcaption>MAP{{printf "%03d" .Info.Num}} {{.Info.Name}}<br>{{len .Info.States}} states, {{.Info.Polygons.Triangles}} triangles</figcaption>
+</figure>
+{{end}}</body>
+</html>
+`))
+
+func writeIndex(path string, thumbs []thumbnail) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := indexTemplate.Execute(f, thumbs); err != nil {
+		log.Fatalf("write %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// drawText draws the string with the label font. Each pixel of a glyph is a
+// scale by scale square.
+func drawText(img draw.Image, x, y int, s string, c color.Color, scale int) {
+	for _, r := range s {
+		glyph, ok := glyphs[r]
+		if !ok {
+			x += (glyphWidth + 1) * scale
+			continue
+		}
+		for gy, row := range glyph {
+			for gx, px := range row {
+				if px != '#' {
+					continue
+				}
+				rect := image.Rect(x+gx*scale, y+gy*scale, x+(gx+1)*scale, y+(gy+1)*scale)
+				draw.Draw(img, rect, image.NewUniform(c), image.Point{}, draw.Src)
+			}
+		}
+		x += (glyphWidth + 1) * scale
+	}
+}
+
+// glyphs is a 3x5 font with only what map labels need.
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+var glyphs = map[rune][glyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'A': {".#.", "#.#", "###", "#.#", "#.#"},
+	'M': {"#.#", "###", "###", "#.#", "#.#"},
+	'P': {"##.", "#.#", "##.", "#..", "#.."},
+}
@@ -1,6 +1,9 @@
 package heretic
 
-import "image/color"
+import (
+	"image/color"
+	"math"
+)
 
 func isTransparent(c color.Color) bool {
 	r, g, b, a := c.RGBA()
@@ -9,7 +12,55 @@ func isTransparent(c color.Color) bool {
 
 // Palette represents the multi-color palette to use during rendering a triangle.
 // FFT palettes are always 16 colors.
-type Palette []color.NRGBA
+type Palette []PaletteColor
+
+// PaletteColor is a single palette entry. STP is the PlayStation
+// semi-transparency bit. Texels with it set are blended with the framebuffer
+// when drawn by a semi-transparent triangle, otherwise they are opaque.
+type PaletteColor struct {
+	color.NRGBA
+	STP bool
+}
+
+// BlendMode is how a semi-transparent triangle combines its color (F) with the
+// color already in the framebuffer (B). The non-opaque modes are the four
+// PlayStation semi-transparency modes.
+type BlendMode int
+
+const (
+	BlendModeOpaque     BlendMode = iota
+	BlendModeAverage              // 0.5B + 0.5F
+	BlendModeAdd                  // B + F
+	BlendModeSubtract             // B - F
+	BlendModeAddQuarter           // B + 0.25F
+)
+
+// blend combines the foreground color f with the background color b. Each
+// channel is clamped to 0-255 like the PlayStation GPU does.
+func blend(b, f color.NRGBA, mode BlendMode) color.NRGBA {
+	channel := func(b, f uint8) uint8 {
+		var v int
+		switch mode {
+		case BlendModeAverage:
+			v = int(b)/2 + int(f)/2
+		case BlendModeAdd:
+			v = int(b) + int(f)
+		case BlendModeSubtract:
+			v = int(b) - int(f)
+		case BlendModeAddQuarter:
+			v = int(b) + int(f)/4
+		default:
+			v = int(f)
+		}
+		return uint8(math.Max(0, math.Min(float64(v), 255)))
+	}
+	return color.NRGBA{
+		R: channel(b.R, f.R),
+		G: channel(b.G, f.G),
+		B: channel(b.B, f.B),
+		A: 255,
+	}
+}
 
 var (
 	ColorBlack = color.NRGBA{0, 0, 0, 255}
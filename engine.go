@@ -1,8 +1,13 @@
 package heretic
 
 import (
+	"fmt"
+	"image"
 	"log"
 	"math"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/veandco/go-sdl2/sdl"
 )
@@ -11,9 +16,17 @@ const (
 	FPS = 60
 	// Number of milliseconds per frame
 	TargetFrameTime = (1000 / FPS)
-)
 
-var autoWire = false
+	// Timestep is how much time each simulation step covers. Animations,
+	// like auto rotation, always move by the same amount each step, so
+	// they are the same regardless of the frame rate.
+	Timestep = time.Second / FPS
+
+	// maxFrameTime limits how many steps Update() simulates after a long
+	// frame, like after the window was dragged, so the engine doesn't fall
+	// further behind trying to catch up.
+	maxFrameTime = 250 * time.Millisecond
+)
 
 type RenderMode int
 
@@ -24,6 +37,23 @@ const (
 	RenderModeMax
 )
 
+var renderModeNames = []string{"texture", "fill", "none"}
+
+func (m RenderMode) String() string { return modeName(renderModeNames, int(m)) }
+
+func (m RenderMode) MarshalText() ([]byte, error) { return []byte(m.String()), nil }
+
+func (m *RenderMode) UnmarshalText(text []byte) (err error) {
+	*m, err = ParseRenderMode(string(text))
+	return err
+}
+
+// ParseRenderMode returns the render mode with the name: texture, fill or none.
+func ParseRenderMode(s string) (RenderMode, error) {
+	i, err := parseMode(renderModeNames, "render", s)
+	return RenderMode(i), err
+}
+
 type WireMode int
 
 const (
@@ -32,6 +62,23 @@ const (
 	WireModeMax
 )
 
+var wireModeNames = []string{"off", "on"}
+
+func (m WireMode) String() string { return modeName(wireModeNames, int(m)) }
+
+func (m WireMode) MarshalText() ([]byte, error) { return []byte(m.String()), nil }
+
+func (m *WireMode) UnmarshalText(text []byte) (err error) {
+	*m, err = ParseWireMode(string(text))
+	return err
+}
+
+// ParseWireMode returns the wire mode with the name: off or on.
+func ParseWireMode(s string) (WireMode, error) {
+	i, err := parseMode(wireModeNames, "wire", s)
+	return WireMode(i), err
+}
+
 type CullMode int
 
 const (
@@ -40,44 +87,126 @@ const (
 	CullModeMax
 )
 
-var leftButtonDown bool = false
+var cullModeNames = []string{"none", "back"}
 
-func NewEngine(window *Window, framebuffer *Framebuffer) *Engine {
-	// Projection matrix. We only need this calculate this once.
-	aspectX := float64(window.width) / float64(window.height)
-	aspectY := float64(window.height) / float64(window.width)
-	fovY := math.Pi / 3.0 // Same as 180/3 or 60deg
-	fovX := math.Atan(math.Tan(fovY/2.0)*aspectX) * 2.0
-	znear := 0.3
-	zfar := 100.0
+func (m CullMode) String() string { return modeName(cullModeNames, int(m)) }
+
+func (m CullMode) MarshalText() ([]byte, error) { return []byte(m.String()), nil }
 
-	return &Engine{
-		window:      window,
+func (m *CullMode) UnmarshalText(text []byte) (err error) {
+	*m, err = ParseCullMode(string(text))
+	return err
+}
+
+// ParseCullMode returns the cull mode with the name: none or back.
+func ParseCullMode(s string) (CullMode, error) {
+	i, err := parseMode(cullModeNames, "cull", s)
+	return CullMode(i), err
+}
+
+func modeName(names []string, i int) string {
+	if i < 0 || i >= len(names) {
+		return fmt.Sprintf("%d", i)
+	}
+	return names[i]
+}
+
+func parseMode(names []string, kind, s string) (int, error) {
+	for i, name := range names {
+		if name == s {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown %s mode %q, expected one of %s", kind, s, strings.Join(names, ", "))
+}
+
+// NewEngine returns an engine that renders into the framebuffer and shows it
+// on the display. They must be the same size.
+func NewEngine(display Display, framebuffer *Framebuffer) *Engine {
+	width, height := display.Size()
+	e := &Engine{
+		display:     display,
+		clock:       SDLClock{},
+		input:       NewSDLInput(DefaultBindings()),
+		width:       width,
+		height:      height,
 		framebuffer: framebuffer,
 		IsRunning:   true,
 
 		ambientLight: DirectionalLight{Direction: Vec3{0, 0, 1}},
 
-		projMatrix: MatrixMakePerspective(fovY, aspectY, znear, zfar),
-		frustum:    NewFrustum(fovX, fovY, znear, zfar),
-		camera:     NewCamera(Vec3{-1.0, 1.0, -1.0}, Vec3{0.0, 0.0, 0.0}, Vec3{0.0, 1.0, 0.0}, window.width, window.height),
+		camera:     NewCamera(Vec3{-1.0, 1.0, -1.0}, Vec3{0.0, 0.0, 0.0}, Vec3{0.0, 1.0, 0.0}, width, height),
 		cullMode:   CullModeBackFace,
 		renderMode: RenderModeTexture,
 		wireMode:   WireModeOff,
 
 		scene: NewScene(),
+
+		// No map is loaded. MAP000 isn't a playable map, so NextMap()
+		// starts at the first one after it.
+		currentMap: 0,
+
 		// Rotation is set so if the user presses spacebar they get some
 		// rotation. But autoRotation is off by default. Use
 		// SetAutoRotation() to override the rotation value.
 		autoRotation: false,
 		rotation:     Vec3{0, 0.5, 0},
 	}
+	e.SetFOV(DefaultFOV)
+	return e
+}
+
+// DefaultFOV is the vertical field of view in radians. Same as 180/3 or 60deg.
+const DefaultFOV = math.Pi / 3.0
+
+// Near and far planes of the projections.
+const (
+	znear = 0.3
+	zfar  = 100.0
+)
+
+// SetFOV sets a perspective projection with the vertical field of view in
+// radians. The horizontal field of view follows from the aspect ratio of the
+// window.
+func (e *Engine) SetFOV(fovY float64) {
+	aspectX := float64(e.width) / float64(e.height)
+	aspectY := float64(e.height) / float64(e.width)
+	fovX := math.Atan(math.Tan(fovY/2.0)*aspectX) * 2.0
+
+	e.projMatrix = MatrixMakePerspective(fovY, aspectY, znear, zfar)
+	e.frustum = NewFrustum(fovX, fovY, znear, zfar)
+	e.orthographic = false
+	e.fovY = fovY
+}
+
+// SetOrthographic sets an orthographic projection that shows height world
+// units vertically. The width follows from the aspect ratio of the window.
+func (e *Engine) SetOrthographic(height float64) {
+	width := height * float64(e.width) / float64(e.height)
+
+	e.projMatrix = MatrixMakeOrtho(-width/2, width/2, -height/2, height/2, znear, zfar)
+	e.frustum = NewOrthoFrustum(width, height, znear, zfar)
+	e.orthographic = true
+	e.orthoHeight = height
 }
 
 // meshReader is a temporary interface to avoid circular imports with the fft
 // package. It will be removed once the project is better organized.
+//
+// Map states (time/weather) are referenced by index so the engine doesn't need
+// to know about fft types. MapNums lists the maps that exist, in order, so the
+// engine never navigates to a missing one.
 type meshReader interface {
-	ReadMesh(mapNum int) Mesh
+	MapNums() []int
+	ReadMeshState(mapNum int, stateIdx int) Mesh
+	NumMapStates(mapNum int) int
+}
+
+// meshTriangle is a projected triangle along with the mesh it came from, so it
+// can be drawn with the mesh's texture after being sorted.
+type meshTriangle struct {
+	triangle Triangle
+	mesh     *Mesh
 }
 
 // Engine is the top level object that contains windows, renderers, etc.
@@ -91,36 +220,70 @@ type meshReader interface {
 // }
 //
 type Engine struct {
-	window      *Window
-	framebuffer *Framebuffer
+	display       Display
+	width, height int
+	framebuffer   *Framebuffer
 
 	IsRunning bool
 
+	// Input translates SDL events into actions. When recorder is set, the
+	// actions and frames are recorded, see Record().
+	input    *SDLInput
+	recorder *Recorder
+
+	// autoWire is set when ActionNextRenderMode turned on the wire mode
+	// for RenderModeNone, so it is turned off again after.
+	autoWire bool
+
 	// Timing
-	previous  uint32
-	deltaTime float64
+	//
+	// Update() simulates in steps of Timestep. The time that isn't a whole
+	// step yet is kept in accumulator and used to interpolate between the
+	// last two steps when projecting.
+	clock       Clock
+	previous    time.Duration
+	accumulator time.Duration
+	deltaTime   float64
 
 	// Rendering
 	cullMode   CullMode
 	renderMode RenderMode
 	wireMode   WireMode
 
-	projMatrix Matrix
-	camera     *Camera
-	frustum    Frustum
+	// renderModeSet keeps Setup() from switching to the texture mode.
+	renderModeSet bool
+
+	projMatrix   Matrix
+	camera       *Camera
+	frustum      Frustum
+	orthographic bool
+
+	// fovY or orthoHeight is what the projection was set up with, so it
+	// can be recorded.
+	fovY        float64
+	orthoHeight float64
 
 	// Model
 	scene *scene
 
-	MeshReader meshReader
-	currentMap int
+	MeshReader   meshReader
+	currentMap   int
+	currentState int
 
 	ambientLight DirectionalLight
 
+	// semiTransparent is reused each frame to collect triangles that
+	// need to be drawn back to front.
+	semiTransparent []meshTriangle
+
 	// These two control the mesh rotating on its own.
 	// The amount can be set by SetAutoRotation().
 	autoRotation bool
 	rotation     Vec3
+
+	// selectedTile highlights the triangles on a terrain tile. It is set
+	// by SelectTile().
+	selectedTile *TileLocation
 }
 
 func (e *Engine) Setup() {
@@ -128,103 +291,167 @@ func (e *Engine) Setup() {
 		log.Fatalln("no mesh specified")
 	}
 
-	// If there is any texture on any mesh, show it.
+	// If there is any texture on any mesh, show it, unless a render mode
+	// was chosen with SetRenderMode().
 	for _, mesh := range e.scene.Meshes {
-		if len(mesh.Texture.data) != 0 {
+		if mesh.Texture != nil && !e.renderModeSet {
 			e.renderMode = RenderModeTexture
 		}
 	}
-	e.previous = sdl.GetTicks()
+	for _, mesh := range e.scene.Meshes {
+		mesh.previousRotation = mesh.Rotation
+	}
+	e.previous = e.clock.Now()
+	e.accumulator = 0
+
+	// Loading took time that isn't in any frame. The new start is
+	// recorded, so a replay starts the scene at the same time.
+	if e.recorder != nil {
+		e.recorder.record(e.previous, RecordedEvent{Load: true})
+	}
 }
 
+// SetClock sets where the engine gets the time from. A FakeClock makes every
+// frame reproducible.
+func (e *Engine) SetClock(clock Clock) {
+	e.clock = clock
+	e.previous = clock.Now()
+}
+
+// ProcessInput handles the SDL events since the last frame. They are
+// translated into actions with the bindings, see SetBindings().
 func (e *Engine) ProcessInput() {
-	// The other mouse/keyboard functionality can be handled via polling.
-	// Moving the keys into keyboard state polling (above) will appear to be
-	// multiple presses in a row when we just want one.
 	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
-		switch t := event.(type) {
-		case *sdl.QuitEvent:
-			e.IsRunning = false
-			break
-		case *sdl.MouseWheelEvent:
-			for i, mesh := range e.scene.Meshes {
-				if t.PreciseY > 0 {
-					e.scene.Meshes[i].Scale = mesh.Scale.Mul(1.1)
-				} else {
-					e.scene.Meshes[i].Scale = mesh.Scale.Div(1.1)
-				}
-			}
-		case *sdl.MouseButtonEvent:
-			if t.Button == sdl.BUTTON_LEFT {
-				leftButtonDown = t.Type == sdl.MOUSEBUTTONDOWN
-			}
-		case *sdl.MouseMotionEvent:
-			if leftButtonDown {
-				e.camera.ProcessMouseMovement(float64(t.XRel), float64(t.YRel), e.deltaTime)
-			}
-		case *sdl.KeyboardEvent:
-			if t.Type != sdl.KEYDOWN {
-				continue
-			}
-			switch t.Keysym.Sym {
-			case sdl.K_ESCAPE:
-				e.IsRunning = false
-				break
-
-			case sdl.K_w:
-				e.wireMode++
-				if e.wireMode == WireModeMax {
-					e.wireMode = 0
-				}
-			case sdl.K_r:
-				// Turn off wire if it was turned on automatically because
-				// RenderModeNode was enabled.
-				if e.renderMode == RenderModeNone && autoWire {
-					autoWire = false
-					e.wireMode = WireModeOff
-				}
+		for _, action := range e.input.Translate(event) {
+			e.HandleAction(action)
+		}
+	}
+}
 
-				e.renderMode++
+// SetBindings sets which keys and mouse buttons do which actions.
+func (e *Engine) SetBindings(bindings Bindings) {
+	e.input = NewSDLInput(bindings)
+}
 
-				// Loop to beginning
-				if e.renderMode == RenderModeMax {
-					e.renderMode = 0
-				}
+// HandleAction does the action. Anything can drive the engine this way, not
+// only SDL events.
+func (e *Engine) HandleAction(event ActionEvent) {
+	if e.recorder != nil {
+		e.recorder.record(e.clock.Now(), RecordedEvent{ActionEvent: event})
+	}
 
-				// Automatically enable wiremode if we are on render mode none.
-				if e.renderMode == RenderModeNone && e.wireMode == WireModeOff {
-					autoWire = true
-					e.wireMode = WireModeOn
-				}
-			case sdl.K_c:
-				e.cullMode++
-				if e.cullMode == CullModeMax {
-					e.cullMode = 0
-				}
-			case sdl.K_k:
-				e.NextMap()
-			case sdl.K_j:
-				e.PrevMap()
-			case sdl.K_SPACE:
-				e.autoRotation = !e.autoRotation
-			}
+	switch event.Action {
+	case ActionQuit:
+		e.IsRunning = false
+	case ActionZoomIn:
+		for i, mesh := range e.scene.Meshes {
+			e.scene.Meshes[i].Scale = mesh.Scale.Mul(1.1)
 		}
+	case ActionZoomOut:
+		for i, mesh := range e.scene.Meshes {
+			e.scene.Meshes[i].Scale = mesh.Scale.Div(1.1)
+		}
+	case ActionOrbit:
+		e.camera.ProcessMouseMovement(event.X, event.Y, e.deltaTime)
+	case ActionToggleWire:
+		e.wireMode++
+		if e.wireMode == WireModeMax {
+			e.wireMode = 0
+		}
+	case ActionNextRenderMode:
+		// Turn off wire if it was turned on automatically because
+		// RenderModeNode was enabled.
+		if e.renderMode == RenderModeNone && e.autoWire {
+			e.autoWire = false
+			e.wireMode = WireModeOff
+		}
+
+		e.renderMode++
+
+		// Loop to beginning
+		if e.renderMode == RenderModeMax {
+			e.renderMode = 0
+		}
+
+		// Automatically enable wiremode if we are on render mode none.
+		if e.renderMode == RenderModeNone && e.wireMode == WireModeOff {
+			e.autoWire = true
+			e.wireMode = WireModeOn
+		}
+	case ActionNextCullMode:
+		e.cullMode++
+		if e.cullMode == CullModeMax {
+			e.cullMode = 0
+		}
+	case ActionNextMap:
+		e.NextMap()
+	case ActionPrevMap:
+		e.PrevMap()
+	case ActionNextMapState:
+		e.NextMapState()
+	case ActionPrevMapState:
+		e.PrevMapState()
+	case ActionToggleRotation:
+		e.autoRotation = !e.autoRotation
+	case ActionNextTile:
+		e.stepTile(1)
+	case ActionPrevTile:
+		e.stepTile(-1)
 	}
 }
 
+// Update waits for the next frame, simulates the time since the last one and
+// projects the scene for Render().
 func (e *Engine) Update() {
 	e.timingDelay()
+	if e.recorder != nil {
+		e.recorder.record(e.previous, RecordedEvent{Frame: true})
+	}
+	d := time.Duration(e.deltaTime * float64(time.Second))
+	if d > maxFrameTime {
+		d = maxFrameTime
+	}
+	e.Advance(d)
+}
 
+// Advance simulates the time passing and projects the scene, without waiting
+// or looking at the clock. The time is simulated in steps of Timestep, any
+// remainder is carried over to the next call and the scene is interpolated
+// between the last two steps by how far into the next step it is.
+//
+// Unlike the frames of Update(), d isn't limited to maxFrameTime, so frames
+// of any length can be rendered offscreen.
+func (e *Engine) Advance(d time.Duration) {
+	e.accumulator += d
+	for e.accumulator >= Timestep {
+		e.step(Timestep.Seconds())
+		e.accumulator -= Timestep
+	}
+	e.project(float64(e.accumulator) / float64(Timestep))
+}
+
+// step moves the animations forward by the seconds.
+func (e *Engine) step(seconds float64) {
 	for _, mesh := range e.scene.Meshes {
+		mesh.previousRotation = mesh.Rotation
+
 		// Apply the engine's rotation vector. This is for automatic rotation.
 		if e.autoRotation {
-			mesh.Rotation = mesh.Rotation.Add(e.rotation.Mul(e.deltaTime))
+			mesh.Rotation = mesh.Rotation.Add(e.rotation.Mul(seconds))
 		}
+	}
+}
+
+// project transforms the triangles to the screen. alpha is how far between
+// the previous and current step the scene is drawn, from 0 to 1.
+func (e *Engine) project(alpha float64) {
+	for _, mesh := range e.scene.Meshes {
+		rotation := mesh.previousRotation.Add(mesh.Rotation.Sub(mesh.previousRotation).Mul(alpha))
 
 		// World matrix. Combination of scale, rotation and translation.
 		worldMatrix := MatrixIdentity()
 		worldMatrix = worldMatrix.Mul(NewScaleMatrix(mesh.Scale))
-		worldMatrix = worldMatrix.Mul(NewRotationMatrix(mesh.Rotation))
+		worldMatrix = worldMatrix.Mul(NewRotationMatrix(rotation))
 		worldMatrix = worldMatrix.Mul(NewTranslationMatrix(mesh.Translation))
 
 		viewMatrix := LookAt(e.camera.eye, e.camera.front, e.camera.up)
@@ -251,6 +478,10 @@ func (e *Engine) Update() {
 			if e.cullMode == CullModeBackFace {
 				origin := Vec3{0, 0, 0}
 				cameraRay := origin.Sub(triangle.Projected[0].Vec3())
+				if e.orthographic {
+					// Every ray is parallel to the view direction.
+					cameraRay = Vec3{0, 0, -1}
+				}
 				visibility := triangle.Normal().Dot(cameraRay)
 				if visibility < 0 {
 					continue
@@ -284,8 +515,8 @@ func (e *Engine) Update() {
 					projected.Y *= -1
 
 					// Scale into view (tiny otherwise)
-					projected.X *= (float64(e.window.width) / 2.0)
-					projected.Y *= (float64(e.window.height) / 2.0)
+					projected.X *= (float64(e.width) / 2.0)
+					projected.Y *= (float64(e.height) / 2.0)
 
 					// Translate the projected points to the
 					// middle of the screen.  FIXME: If this
@@ -294,8 +525,8 @@ func (e *Engine) Update() {
 					// would be in top left, but I don't
 					// understand why the viewport/frustum
 					// is changed.
-					projected.X += (float64(e.window.width) / 2.0)
-					projected.Y += (float64(e.window.height) / 2.0)
+					projected.X += (float64(e.width) / 2.0)
+					projected.Y += (float64(e.height) / 2.0)
 
 					triangleToRender.Projected[i] = projected
 				}
@@ -318,18 +549,18 @@ func (e *Engine) Render() {
 
 	e.framebuffer.ClearDepth()
 
+	// Opaque triangles are drawn first in any order since the zbuffer
+	// sorts them out. Semi-transparent triangles are collected and drawn
+	// afterwards, back to front, since blending depends on what is
+	// already in the framebuffer.
+	e.semiTransparent = e.semiTransparent[:0]
 	for _, mesh := range e.scene.Meshes {
 		for _, triangle := range mesh.trianglesToRender {
-
-			if e.renderMode == RenderModeTexture && triangle.HasTexture() {
-				e.framebuffer.DrawTexturedTriangle(triangle, mesh.Texture)
-			} else if e.renderMode != RenderModeNone {
-				e.framebuffer.DrawFilledTriangle(triangle, triangle.Color)
-			}
-
-			if e.wireMode == WireModeOn {
-				e.framebuffer.DrawTriangle(triangle, ColorWhite)
+			if triangle.IsSemiTransparent() {
+				e.semiTransparent = append(e.semiTransparent, meshTriangle{triangle, mesh})
+				continue
 			}
+			e.drawTriangle(triangle, mesh.Texture)
 		}
 
 		// Clear the slice while retaining capacity so we don't have to
@@ -339,8 +570,33 @@ func (e *Engine) Render() {
 		mesh.trianglesToRender = mesh.trianglesToRender[:0]
 	}
 
+	sort.SliceStable(e.semiTransparent, func(i, j int) bool {
+		return e.semiTransparent[i].triangle.Depth() > e.semiTransparent[j].triangle.Depth()
+	})
+	for _, mt := range e.semiTransparent {
+		e.drawTriangle(mt.triangle, mt.mesh.Texture)
+	}
+
 	// Render ColorBuffer
-	e.window.Update(e.framebuffer)
+	e.display.Update(e.framebuffer)
+}
+
+// drawTriangle draws a single projected triangle according to the render and
+// wire modes.
+func (e *Engine) drawTriangle(triangle Triangle, texture Sampler) {
+	if e.renderMode == RenderModeTexture && triangle.HasTexture() && texture != nil {
+		e.framebuffer.DrawTexturedTriangle(triangle, texture)
+	} else if e.renderMode != RenderModeNone {
+		e.framebuffer.DrawFilledTriangle(triangle, triangle.Color)
+	}
+
+	if e.wireMode == WireModeOn {
+		e.framebuffer.DrawTriangle(triangle, ColorWhite)
+	}
+
+	if e.selectedTile != nil && triangle.Tile != nil && *triangle.Tile == *e.selectedTile {
+		e.framebuffer.DrawTriangle(triangle, ColorYellow)
+	}
 }
 
 func (e *Engine) SetMesh(mesh Mesh) {
@@ -351,41 +607,161 @@ func (e *Engine) AppendMesh(mesh Mesh) {
 	e.scene.Meshes = append(e.scene.Meshes, &mesh)
 }
 
+// SelectTile outlines the triangles that sit on the terrain tile. Passing nil
+// clears the selection.
+func (e *Engine) SelectTile(loc *TileLocation) {
+	e.selectedTile = loc
+}
+
+// SelectedTile returns the outlined terrain tile, or nil if there isn't one.
+func (e *Engine) SelectedTile() *TileLocation {
+	return e.selectedTile
+}
+
+// stepTile selects the next (dir 1) or previous (dir -1) tile that triangles
+// of the scene sit on, in the order the triangles are in. Stepping past
+// either end clears the selection, so no tile is outlined.
+func (e *Engine) stepTile(dir int) {
+	var tiles []TileLocation
+	seen := map[TileLocation]bool{}
+	current := -1
+	for _, mesh := range e.scene.Meshes {
+		for _, t := range mesh.Triangles {
+			if t.Tile == nil || seen[*t.Tile] {
+				continue
+			}
+			seen[*t.Tile] = true
+			if e.selectedTile != nil && *t.Tile == *e.selectedTile {
+				current = len(tiles)
+			}
+			tiles = append(tiles, *t.Tile)
+		}
+	}
+
+	// -1 and len(tiles) are both no selection.
+	next := current + dir
+	if current == -1 && dir < 0 {
+		next = len(tiles) - 1
+	}
+	if next < 0 || next >= len(tiles) {
+		e.selectedTile = nil
+		return
+	}
+	e.selectedTile = &tiles[next]
+}
+
+// SetRenderMode sets how triangles are filled. Loading a textured mesh no
+// longer switches to RenderModeTexture afterwards.
+func (e *Engine) SetRenderMode(mode RenderMode) {
+	e.renderMode = mode
+	e.renderModeSet = true
+}
+
+// SetWireMode sets whether triangle outlines are drawn.
+func (e *Engine) SetWireMode(mode WireMode) {
+	e.wireMode = mode
+}
+
+// SetCullMode sets whether back faces are culled.
+func (e *Engine) SetCullMode(mode CullMode) {
+	e.cullMode = mode
+}
+
+// Image returns a copy of the last rendered frame.
+func (e *Engine) Image() *image.NRGBA {
+	return e.framebuffer.Image()
+}
+
+// Camera returns the camera, so it can be moved like the mouse does.
+func (e *Engine) Camera() *Camera {
+	return e.camera
+}
+
+// SetCamera places the camera at eye looking at target. The mouse rotates the
+// camera around target.
+func (e *Engine) SetCamera(eye, target, up Vec3) {
+	e.camera = NewCamera(eye, target, up, e.width, e.height)
+}
+
 func (e *Engine) SetAutoRotation(v Vec3) {
 	e.rotation = v
 	e.autoRotation = true
 }
 
-// Move to the next FFT map. This is pretty hacky.
+// LoadMap loads the FFT map in the state with the index. The map number must
+// be one of MeshReader.MapNums().
+func (e *Engine) LoadMap(mapNum, stateIdx int) {
+	e.currentMap = mapNum
+	e.currentState = stateIdx
+	e.loadMap()
+}
+
+// NextMap moves to the next FFT map that exists. Before any map is loaded, it
+// loads the first one after MAP000, which isn't a playable map.
 func (e *Engine) NextMap() {
-	if e.currentMap < 125 {
-		e.currentMap++
-		mesh := e.MeshReader.ReadMesh(e.currentMap)
-		e.SetMesh(mesh)
-		e.Setup()
+	for _, num := range e.MeshReader.MapNums() {
+		if num > e.currentMap {
+			e.currentMap = num
+			e.currentState = 0
+			e.loadMap()
+			return
+		}
 	}
 }
 
-// Move to the previous FFT map. This is pretty hacky.
+// PrevMap moves to the previous FFT map that exists.
 func (e *Engine) PrevMap() {
-	if e.currentMap > 1 {
-		e.currentMap--
-		mesh := e.MeshReader.ReadMesh(e.currentMap)
-		e.SetMesh(mesh)
-		e.Setup()
+	nums := e.MeshReader.MapNums()
+	for i := len(nums) - 1; i >= 0; i-- {
+		if nums[i] < e.currentMap {
+			e.currentMap = nums[i]
+			e.currentState = 0
+			e.loadMap()
+			return
+		}
 	}
 }
 
+// NextMapState moves to the next time/weather state of the current map,
+// wrapping around to the first.
+func (e *Engine) NextMapState() {
+	n := e.MeshReader.NumMapStates(e.currentMap)
+	if n <= 1 {
+		return
+	}
+	e.currentState = (e.currentState + 1) % n
+	e.loadMap()
+}
+
+// PrevMapState moves to the previous time/weather state of the current map,
+// wrapping around to the last.
+func (e *Engine) PrevMapState() {
+	n := e.MeshReader.NumMapStates(e.currentMap)
+	if n <= 1 {
+		return
+	}
+	e.currentState = (e.currentState + n - 1) % n
+	e.loadMap()
+}
+
+// loadMap reads the current map and state and makes it the only mesh.
+func (e *Engine) loadMap() {
+	mesh := e.MeshReader.ReadMeshState(e.currentMap, e.currentState)
+	e.SetMesh(mesh)
+	e.Setup()
+}
+
 func (e *Engine) timingDelay() {
 	// Target the specified FPS
-	wait := TargetFrameTime - (sdl.GetTicks() - e.previous)
-	if wait > 0 && wait <= TargetFrameTime {
-		sdl.Delay(wait)
+	frameTime := time.Duration(TargetFrameTime) * time.Millisecond
+	wait := frameTime - (e.clock.Now() - e.previous)
+	if wait > 0 && wait <= frameTime {
+		e.clock.Sleep(wait)
 	}
 
-	// Using a deltaTime for transformations keeps animation speed
-	// consistent regardless of FPS. It basically changes the engine
-	// transforms-per-frame to tranforms-per-second.
-	e.deltaTime = float64(sdl.GetTicks()-e.previous) / 1000.0
-	e.previous = sdl.GetTicks()
+	// deltaTime is the real time of the frame. Animations are simulated
+	// in fixed steps from it, input like mouse movement uses it directly.
+	now := e.clock.Now()
+	e.deltaTime = (now - e.previous).Seconds()
+	e.previous = now
 }
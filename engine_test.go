@@ -0,0 +1,22 @@
+package heretic
+
+import "testing"
+
+// discMeshReader lists the maps like the disc does, starting with MAP000.
+type discMeshReader struct{ testMeshReader }
+
+func (r discMeshReader) MapNums() []int { return []int{0, 1, 2} }
+
+func TestNextMapSkipsMap000(t *testing.T) {
+	engine := NewEngine(NewOffscreen(64, 64), NewFramebuffer(64, 64))
+	engine.MeshReader = discMeshReader{}
+
+	engine.NextMap()
+	if engine.currentMap != 1 {
+		t.Errorf("first NextMap() loaded map %d, want 1", engine.currentMap)
+	}
+	engine.NextMap()
+	if engine.currentMap != 2 {
+		t.Errorf("second NextMap() loaded map %d, want 2", engine.currentMap)
+	}
+}
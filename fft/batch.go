@@ -0,0 +1,101 @@
+// This file contains a way to load many maps at once.
+//
+// Generating assets means reading every map on the disc. Each map is
+// independent, so they are read concurrently by a bounded pool of workers.
+// A map that fails to load is reported, but doesn't stop the others.
+package fft
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// MapNums returns the number of every map that exists in the source.
+func (r MeshReader) MapNums() []int {
+	return r.source.Version().MapNums()
+}
+
+// BatchOptions configures LoadMaps.
+type BatchOptions struct {
+	// Workers is the number of maps read at once. It defaults to the
+	// number of CPUs.
+	Workers int
+
+	// State is the time/weather state to read each map in.
+	State MapState
+}
+
+// BatchResult is the outcome of loading a single map.
+type BatchResult struct {
+	MapNum int
+	Map    Map
+	Err    error
+}
+
+// LoadMaps reads the maps concurrently. handle is called once for every map
+// that was read, along with how many maps are done so far out of the total.
+// It is always called from the goroutine that called LoadMaps, so it doesn't
+// need to be safe for concurrent use. Results arrive in the order the maps
+// finish, not the order of mapNums.
+//
+// If ctx is cancelled, no more maps are started, the maps being read stop
+// before their next file, nothing more is handled, and ctx.Err() is returned.
+func (r MeshReader) LoadMaps(ctx context.Context, mapNums []int, opts BatchOptions, handle func(result BatchResult, done, total int)) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan int)
+	results := make(chan BatchResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for num := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				m, err := r.ReadMapContext(ctx, num, opts.State)
+				results <- BatchResult{MapNum: num, Map: m, Err: err}
+			}
+		}()
+	}
+
+	// Feed the workers until we run out of maps or get cancelled.
+	go func() {
+		defer close(jobs)
+		for _, num := range mapNums {
+			// select picks at random when both are ready, so a
+			// cancelled ctx could still send the next map.
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case jobs <- num:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	done := 0
+	for result := range results {
+		// Workers may have finished or stopped part way through a
+		// map when ctx was cancelled. Those are dropped.
+		if ctx.Err() != nil {
+			continue
+		}
+		done++
+		handle(result, done, len(mapNums))
+	}
+	return ctx.Err()
+}
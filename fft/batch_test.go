@@ -0,0 +1,62 @@
+package fft
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLoadMaps(t *testing.T) {
+	r := testReader(t, testImages(t)["iso"])
+
+	// Map 0 isn't on the fixture disc, so it fails without stopping the
+	// others.
+	mapNums := []int{0, testMapNum, testAltMapNum}
+	errs := map[int]error{}
+	calls := 0
+	err := r.LoadMaps(context.Background(), mapNums, BatchOptions{Workers: 2}, func(result BatchResult, done, total int) {
+		calls++
+		if done != calls || total != len(mapNums) {
+			t.Errorf("done/total = %d/%d, want %d/%d", done, total, calls, len(mapNums))
+		}
+		errs[result.MapNum] = result.Err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != len(mapNums) {
+		t.Fatalf("handled %d maps, want %d", calls, len(mapNums))
+	}
+	if errs[0] == nil {
+		t.Error("expected an error for map 0")
+	}
+	if errs[testMapNum] != nil || errs[testAltMapNum] != nil {
+		t.Errorf("unexpected errors: %v, %v", errs[testMapNum], errs[testAltMapNum])
+	}
+}
+
+func TestLoadMapsCancel(t *testing.T) {
+	r := testReader(t, testImages(t)["iso"])
+	mapNums := []int{testMapNum, testAltMapNum, testMapNum, testAltMapNum}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := r.LoadMaps(ctx, mapNums, BatchOptions{Workers: 1}, func(result BatchResult, done, total int) {
+		calls++
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Errorf("LoadMaps() = %v, want %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("handled %d maps after cancelling, want 1", calls)
+	}
+}
+
+func TestReadMapContextCancelled(t *testing.T) {
+	r := testReader(t, testImages(t)["iso"])
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.ReadMapContext(ctx, testMapNum, DefaultMapState); err != context.Canceled {
+		t.Errorf("ReadMapContext() = %v, want %v", err, context.Canceled)
+	}
+}
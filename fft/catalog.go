@@ -0,0 +1,310 @@
+// This file contains a catalog of the maps in a source.
+//
+// Not every map number in the sector table is a map, and some maps only exist
+// in certain states. The catalog reads the GNS file and mesh header of every
+// map once, so callers can list and navigate the maps without reading them.
+package fft
+
+import (
+	"fmt"
+
+	"github.com/adamrt/heretic"
+)
+
+// MapInfo describes a map without reading its mesh or texture.
+type MapInfo struct {
+	Num  int
+	Name string
+
+	// States are the time/weather states the map has records for,
+	// ordered by time and then weather.
+	States []MapState
+
+	// Number of GNS records of each kind.
+	Records   int
+	Meshes    int // Primary and alternate meshes
+	Overrides int
+	Textures  int
+
+	// Polygons are the counts of the mesh read for DefaultMapState.
+	Polygons PolygonCounts
+}
+
+// PolygonCounts are the number of each kind of polygon in a mesh.
+type PolygonCounts struct {
+	TexturedTriangles   int `json:"textured_triangles"`
+	TexturedQuads       int `json:"textured_quads"`
+	UntexturedTriangles int `json:"untextured_triangles"`
+	UntexturedQuads     int `json:"untextured_quads"`
+}
+
+// Triangles returns the number of triangles once quads have been split.
+func (c PolygonCounts) Triangles() int {
+	return c.TexturedTriangles + c.TexturedQuads*2 + c.UntexturedTriangles + c.UntexturedQuads*2
+}
+
+// MapName returns the location name of the map, or "MAP000" style name if it
+// isn't known.
+func MapName(mapNum int) string {
+	if mapNum >= 0 && mapNum < len(MapNames) && MapNames[mapNum] != "" {
+		return MapNames[mapNum]
+	}
+	return fmt.Sprintf("MAP%03d", mapNum)
+}
+
+// MapInfo reads the GNS file and mesh header of the map. An error is returned
+// if the map doesn't exist or has no mesh.
+func (r MeshReader) MapInfo(mapNum int) (MapInfo, error) {
+	records, err := r.readGNSRecords(mapNum)
+	if err != nil {
+		return MapInfo{}, err
+	}
+
+	info := MapInfo{
+		Num:     mapNum,
+		Name:    MapName(mapNum),
+		States:  recordStates(records),
+		Records: len(records),
+	}
+	for _, record := range records {
+		switch record.Type() {
+		case RecordTypeMeshPrimary, RecordTypeMeshAlt:
+			info.Meshes++
+		case RecordTypeMeshOverride:
+			info.Overrides++
+		case RecordTypeTexture:
+			info.Textures++
+		}
+	}
+
+	// Same selection as ReadMapRaw.
+	meshRecord := selectRecord(records, RecordTypeMeshPrimary, DefaultMapState)
+	if meshRecord == nil {
+		meshRecord = selectRecord(records, RecordTypeMeshAlt, DefaultMapState)
+	}
+	if meshRecord == nil {
+		return MapInfo{}, fmt.Errorf("map %d has no mesh", mapNum)
+	}
+	info.Polygons, err = r.readPolygonCounts(mapNum, meshRecord)
+	if err != nil {
+		return MapInfo{}, fmt.Errorf("map %d: %w", mapNum, err)
+	}
+	return info, nil
+}
+
+// readPolygonCounts reads only the file header and mesh header of a mesh.
+func (r MeshReader) readPolygonCounts(mapNum int, record GNSRecord) (PolygonCounts, error) {
+	data, err := r.source.Resource(mapNum, record)
+	if err != nil {
+		return PolygonCounts{}, err
+	}
+	dr := newDataReader(data, 0)
+	fileHeader := meshFileHeader(dr.readBytes(meshFileHeaderLen))
+	if dr.err != nil {
+		return PolygonCounts{}, fmt.Errorf("read mesh file header: %w", dr.err)
+	}
+	ptr := fileHeader.PrimaryMesh()
+	if ptr == 0 {
+		return PolygonCounts{}, nil
+	}
+	dr = newDataReader(data, ptr)
+	header := meshHeader(dr.readBytes(meshHeaderLen))
+	if dr.err != nil {
+		return PolygonCounts{}, fmt.Errorf("read mesh header: %w", dr.err)
+	}
+	return PolygonCounts{
+		TexturedTriangles:   header.N(),
+		TexturedQuads:       header.P(),
+		UntexturedTriangles: header.Q(),
+		UntexturedQuads:     header.R(),
+	}, nil
+}
+
+// Catalog is the list of maps that can be read from a source. It implements
+// the engine's map reader, so the engine only navigates to maps that exist.
+type Catalog struct {
+	reader MeshReader
+	maps   []MapInfo
+	errs   map[int]error
+}
+
+// NewCatalog reads the info of every map in the source. Maps that can't be
+// read are left out, Err returns why.
+func NewCatalog(r MeshReader) Catalog {
+	c := Catalog{reader: r, errs: map[int]error{}}
+	for _, num := range r.MapNums() {
+		info, err := r.MapInfo(num)
+		if err != nil {
+			c.errs[num] = err
+			continue
+		}
+		c.maps = append(c.maps, info)
+	}
+	return c
+}
+
+// Maps returns the info of every map, ordered by number.
+func (c Catalog) Maps() []MapInfo {
+	return c.maps
+}
+
+// Map returns the info of a map and whether it is in the catalog.
+func (c Catalog) Map(mapNum int) (MapInfo, bool) {
+	for _, info := range c.maps {
+		if info.Num == mapNum {
+			return info, true
+		}
+	}
+	return MapInfo{}, false
+}
+
+// Err returns why a map was left out of the catalog, or nil if it wasn't.
+func (c Catalog) Err(mapNum int) error {
+	return c.errs[mapNum]
+}
+
+// MapNums returns the number of every map in the catalog, in order.
+func (c Catalog) MapNums() []int {
+	nums := make([]int, len(c.maps))
+	for i, info := range c.maps {
+		nums[i] = info.Num
+	}
+	return nums
+}
+
+// ReadMeshState reads a map using an index into its states. It exits if the
+// map can't be read, like MeshReader.ReadMesh.
+func (c Catalog) ReadMeshState(mapNum int, stateIdx int) heretic.Mesh {
+	info, _ := c.Map(mapNum)
+	if stateIdx < 0 || stateIdx >= len(info.States) {
+		return c.reader.ReadMesh(mapNum, DefaultMapState)
+	}
+	return c.reader.ReadMesh(mapNum, info.States[stateIdx])
+}
+
+// NumMapStates returns the number of states of the map.
+func (c Catalog) NumMapStates(mapNum int) int {
+	info, _ := c.Map(mapNum)
+	return len(info.States)
+}
+
+// MapNames are the location names of the maps on the North American disc,
+// as listed by the FFHacktics community. Some locations have more than one
+// map, the later ones are numbered to tell them apart. Maps without a name,
+// like the ones after the Deep Dungeon, fall back to their number in MapName.
+var MapNames = [126]string{
+	1:   "At Main Gate of Igros Castle",
+	2:   "Back Gate of Lesalia Castle",
+	3:   "Hall of St. Murond Temple",
+	4:   "Office of Lesalia Castle",
+	5:   "Roof of Riovanes Castle",
+	6:   "At the Gate of Riovanes Castle",
+	7:   "Inside of Riovanes Castle",
+	8:   "Riovanes Castle",
+	9:   "Citadel of Igros Castle",
+	10:  "Inside of Igros Castle",
+	11:  "Office of Igros Castle",
+	12:  "At the Gate of Lionel Castle",
+	13:  "Inside of Lionel Castle",
+	14:  "Office of Lionel Castle",
+	15:  "At the Gate of Limberry Castle",
+	16:  "Inside of Limberry Castle",
+	17:  "Underground Cemetery of Limberry Castle",
+	18:  "Office of Limberry Castle",
+	19:  "At the Gate of Limberry Castle (2)",
+	20:  "Inside of Zeltennia Castle",
+	21:  "Zeltennia Castle",
+	22:  "Magic City Gariland",
+	23:  "Belouve Residence",
+	24:  "Military Academy's Auditorium",
+	25:  "Yardow Fort City",
+	26:  "Weapon Storage of Yardow",
+	27:  "Goland Coal City",
+	28:  "Colliery Underground First Floor",
+	29:  "Colliery Underground Second Floor",
+	30:  "Colliery Underground Third Floor",
+	31:  "Dorter Trade City",
+	32:  "Slums in Dorter",
+	33:  "Hospital in Slums",
+	34:  "Cellar of Sand Mouse",
+	35:  "Zaland Fort City",
+	36:  "Church Outside of Town",
+	37:  "Ruins Outside Zaland",
+	38:  "Goug Machine City",
+	39:  "Underground Passage in Goland",
+	40:  "Slums in Goug",
+	41:  "Besrodio's House",
+	42:  "Warjilis Trade City",
+	43:  "Port of Warjilis",
+	44:  "Bervenia Free City",
+	45:  "Ruins of Zeltennia Castle's Church",
+	46:  "Cemetery of Heavenly Knight, Balbanes",
+	47:  "Zarghidas Trade City",
+	48:  "Slums of Zarghidas",
+	49:  "Fort Zeakden",
+	50:  "St. Murond Temple",
+	51:  "St. Murond Temple (2)",
+	52:  "Chapel of St. Murond Temple",
+	53:  "Entrance to Death City",
+	54:  "Lost Sacred Precincts",
+	55:  "Graveyard of Airships",
+	56:  "Graveyard of Airships (2)",
+	57:  "Underground Book Storage First Floor",
+	58:  "Underground Book Storage Second Floor",
+	59:  "Underground Book Storage Third Floor",
+	60:  "Underground Book Storage Fourth Floor",
+	61:  "Underground Book Storage Fifth Floor",
+	62:  "Chapel of Orbonne Monastery",
+	63:  "Golgorand Execution Site",
+	64:  "In Front of Bethla Garrison's Sluice",
+	65:  "Granary of Bethla Garrison",
+	66:  "South Wall of Bethla Garrison",
+	67:  "North Wall of Bethla Garrison",
+	68:  "Bethla Garrison",
+	69:  "Murond Death City",
+	70:  "Nelveska Temple",
+	71:  "Dolbodar Swamp",
+	72:  "Fovoham Plains",
+	73:  "Inside of Windmill Shed",
+	74:  "Sweegy Woods",
+	75:  "Bervenia Volcano",
+	76:  "Zeklaus Desert",
+	77:  "Lenalia Plateau",
+	78:  "Zigolis Swamp",
+	79:  "Yuguo Woods",
+	80:  "Araguay Woods",
+	81:  "Grog Hill",
+	82:  "Bed Desert",
+	83:  "Zirekile Falls",
+	84:  "Bariaus Hill",
+	85:  "Mandalia Plains",
+	86:  "Doguola Pass",
+	87:  "Bariaus Valley",
+	88:  "Finath River",
+	89:  "Poeskas Lake",
+	90:  "Germinas Peak",
+	91:  "Thieves Fort",
+	92:  "Igros-Belouve Residence",
+	93:  "Broke Down Shed-Wooden Building",
+	94:  "Broke Down Shed-Stone Building",
+	95:  "Church",
+	96:  "Pub",
+	97:  "Inside Castle Gate in Lesalia",
+	98:  "Outside Castle Gate in Lesalia",
+	99:  "Main Street of Lesalia",
+	100: "Public Cemetery",
+	101: "Tutorial (1)",
+	102: "Tutorial (2)",
+	103: "Windmill Shed",
+	104: "Belouve Residence (2)",
+	105: "Deep Dungeon TERMINATE",
+	106: "Deep Dungeon DELTA",
+	107: "Deep Dungeon NOGIAS",
+	108: "Deep Dungeon VOYAGE",
+	109: "Deep Dungeon BRIDGE",
+	110: "Deep Dungeon VALKYRIES",
+	111: "Deep Dungeon MLAPAN",
+	112: "Deep Dungeon TIGER",
+	113: "Deep Dungeon HORROR",
+	114: "Deep Dungeon END",
+}
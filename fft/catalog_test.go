@@ -0,0 +1,60 @@
+package fft
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	c := NewCatalog(testReader(t, testImages(t)["iso"]))
+
+	if nums := c.MapNums(); !reflect.DeepEqual(nums, []int{testMapNum, testAltMapNum}) {
+		t.Fatalf("map nums = %v", nums)
+	}
+	if c.Err(0) == nil {
+		t.Error("expected an error for map 0, which isn't on the disc")
+	}
+
+	info, ok := c.Map(testMapNum)
+	if !ok {
+		t.Fatal("map not in catalog")
+	}
+	want := MapInfo{
+		Num:       testMapNum,
+		Name:      "At Main Gate of Igros Castle",
+		States:    []MapState{DefaultMapState, testNight},
+		Records:   5,
+		Meshes:    2,
+		Overrides: 1,
+		Textures:  2,
+		Polygons:  PolygonCounts{TexturedTriangles: 3, TexturedQuads: 1, UntexturedTriangles: 1, UntexturedQuads: 1},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("info = %+v, want %+v", info, want)
+	}
+	if n := c.NumMapStates(testMapNum); n != 2 {
+		t.Errorf("states = %d, want 2", n)
+	}
+	if n, want := info.Polygons.Triangles(), len(testMap().Mesh.Triangles); n != want {
+		t.Errorf("triangles = %d, want %d", n, want)
+	}
+}
+
+func TestMapName(t *testing.T) {
+	if name := MapName(125); name != "MAP125" {
+		t.Errorf("name = %q, want the fallback", name)
+	}
+
+	// Every map on the disc up to the Deep Dungeon has its own name.
+	seen := map[string]int{}
+	for num := 1; num <= 114; num++ {
+		name := MapNames[num]
+		if name == "" {
+			t.Errorf("map %d has no name", num)
+		}
+		if other, ok := seen[name]; ok {
+			t.Errorf("maps %d and %d are both %q", other, num, name)
+		}
+		seen[name] = num
+	}
+}
@@ -0,0 +1,198 @@
+// This file contains the ability to identify which release of FFT a disc is.
+//
+// Each release puts the MAP files at different sectors, so the sector table has
+// to match the disc. A disc is identified by the executable named in
+// SYSTEM.CNF and the sectors of the GNS files in the MAP directory, which have
+// to be the ones in the version's sector table. The volume ID and the SHA-1 of
+// the executable are also checked for versions that list them, but no known
+// version lists them yet. Discs that don't match a known version are refused
+// instead of being read with the wrong sectors.
+package fft
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DiscVersion is a release of the game and where its maps are.
+type DiscVersion struct {
+	Name   string
+	Serial string
+
+	// Executable is the boot executable named in SYSTEM.CNF.
+	Executable string
+
+	// VolumeID and ExecutableSHA1 are only checked when they are set.
+	// ExecutableSHA1 can list multiple revisions that share the same
+	// sector table.
+	VolumeID       string
+	ExecutableSHA1 []string
+
+	GNSSectors [126]int64
+}
+
+// MapNums returns the number of every map that exists on this version of the
+// disc. Some sector entries are zero because there is no map with that number.
+func (v *DiscVersion) MapNums() []int {
+	nums := []int{}
+	for num, sector := range v.GNSSectors {
+		if sector != 0 {
+			nums = append(nums, num)
+		}
+	}
+	return nums
+}
+
+// DiscUS is the North American release. It is the only version with a known
+// sector table. Its volume ID and the SHA-1 of its executable haven't been
+// taken from a verified dump, so it is identified only by the executable name
+// and the GNS sectors. Set them here once they are known.
+var DiscUS = &DiscVersion{
+	Name:       "Final Fantasy Tactics (USA)",
+	Serial:     "SCUS-94221",
+	Executable: "SCUS_942.21",
+	GNSSectors: GNSSectors,
+}
+
+// KnownDiscs are the versions that Identify can detect.
+var KnownDiscs = []*DiscVersion{DiscUS}
+
+// DiscInfo is what Identify found on a disc.
+type DiscInfo struct {
+	VolumeID       string
+	Executable     string
+	ExecutableSHA1 string
+
+	// GNSSectors are the sectors of the GNS files in the MAP directory, by
+	// map number.
+	GNSSectors map[int]int64
+
+	// Version is the matching known version.
+	Version *DiscVersion
+}
+
+// Identify reads the volume ID and boot executable of the disc and matches
+// them against KnownDiscs. An error is returned if the disc can't be read or
+// isn't a known version. The DiscInfo is still returned for unknown discs so
+// the caller can report what was found.
+func Identify(data io.ReaderAt) (DiscInfo, error) {
+	volumeID, _, err := readPVD(data)
+	if err != nil {
+		return DiscInfo{}, fmt.Errorf("not an ISO9660 image: %w", err)
+	}
+	info := DiscInfo{VolumeID: volumeID}
+
+	cnf, err := readISOFile(data, "SYSTEM.CNF")
+	if err != nil {
+		return info, fmt.Errorf("not a PlayStation disc: %w", err)
+	}
+	info.Executable, err = bootExecutable(cnf)
+	if err != nil {
+		return info, err
+	}
+
+	exe, err := readISOFile(data, info.Executable)
+	if err != nil {
+		return info, fmt.Errorf("read boot executable: %w", err)
+	}
+	if !bytes.HasPrefix(exe, []byte(psxExeMagic)) {
+		return info, fmt.Errorf("boot executable %s is not a PlayStation executable", info.Executable)
+	}
+	sum := sha1.Sum(exe)
+	info.ExecutableSHA1 = hex.EncodeToString(sum[:])
+
+	info.GNSSectors, err = readGNSSectors(data)
+	if err != nil {
+		return info, err
+	}
+
+	for _, v := range KnownDiscs {
+		if v.matches(info) {
+			info.Version = v
+			return info, nil
+		}
+	}
+	return info, fmt.Errorf("unknown disc: volume %q, executable %s (sha1 %s), %d GNS files", info.VolumeID, info.Executable, info.ExecutableSHA1, len(info.GNSSectors))
+}
+
+// psxExeMagic starts the header of every PlayStation executable.
+const psxExeMagic = "PS-X EXE"
+
+func (v *DiscVersion) matches(info DiscInfo) bool {
+	if !strings.EqualFold(v.Executable, info.Executable) {
+		return false
+	}
+	// The sector table is what the version is needed for, so it has to
+	// match the files on the disc.
+	if len(info.GNSSectors) == 0 {
+		return false
+	}
+	for num, sector := range info.GNSSectors {
+		if num >= len(v.GNSSectors) || v.GNSSectors[num] != sector {
+			return false
+		}
+	}
+	if v.VolumeID != "" && v.VolumeID != info.VolumeID {
+		return false
+	}
+	if len(v.ExecutableSHA1) == 0 {
+		return true
+	}
+	for _, sum := range v.ExecutableSHA1 {
+		if strings.EqualFold(sum, info.ExecutableSHA1) {
+			return true
+		}
+	}
+	return false
+}
+
+// readGNSSectors returns the sector of every MAPnnn.GNS file in the MAP
+// directory.
+func readGNSSectors(data io.ReaderAt) (map[int]int64, error) {
+	dir, err := findISOFile(data, "MAP")
+	if err != nil {
+		return nil, fmt.Errorf("no MAP directory: %w", err)
+	}
+	files, err := readDirectory(data, dir)
+	if err != nil {
+		return nil, err
+	}
+	sectors := map[int]int64{}
+	for _, f := range files {
+		var num int
+		if _, err := fmt.Sscanf(strings.ToUpper(f.name), "MAP%03d.GNS", &num); err != nil || f.isDir {
+			continue
+		}
+		sectors[num] = f.sector
+	}
+	return sectors, nil
+}
+
+// bootExecutable returns the file name from the BOOT line of SYSTEM.CNF. The
+// line looks like "BOOT = cdrom:\SCUS_942.21;1".
+func bootExecutable(cnf []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(cnf))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found || strings.TrimSpace(key) != "BOOT" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		value = strings.TrimPrefix(value, "cdrom:")
+		value = strings.TrimLeft(value, `\/`)
+		if i := strings.IndexByte(value, ';'); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.ReplaceAll(value, `\`, "/")
+		if value == "" {
+			break
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("no BOOT line in SYSTEM.CNF")
+}
@@ -0,0 +1,113 @@
+package fft
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// withKnownDiscs replaces KnownDiscs for the rest of the test.
+func withKnownDiscs(t *testing.T, discs ...*DiscVersion) {
+	t.Helper()
+	known := KnownDiscs
+	KnownDiscs = discs
+	t.Cleanup(func() { KnownDiscs = known })
+}
+
+func TestIdentifyExecutableSHA1(t *testing.T) {
+	disc := testDisc(t)
+	iso, err := disc.ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(disc.Executable)
+
+	version := *DiscUS
+	withKnownDiscs(t, &version)
+
+	version.ExecutableSHA1 = []string{hex.EncodeToString(sum[:])}
+	if _, err := Identify(iso); err != nil {
+		t.Errorf("matching executable: %v", err)
+	}
+
+	other := sha1.Sum([]byte("PS-X EXE another revision"))
+	version.ExecutableSHA1 = []string{hex.EncodeToString(other[:])}
+	if _, err := Identify(iso); err == nil {
+		t.Error("expected an error for an executable with a different hash")
+	}
+}
+
+func TestIdentifyVolumeID(t *testing.T) {
+	iso, err := testDisc(t).ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := *DiscUS
+	version.VolumeID = "SOMETHING_ELSE"
+	withKnownDiscs(t, &version)
+	if _, err := Identify(iso); err == nil {
+		t.Error("expected an error for a different volume ID")
+	}
+}
+
+func TestIdentifyNotExecutable(t *testing.T) {
+	disc := testDisc(t)
+	disc.Executable = []byte("not an executable")
+	iso, err := disc.ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Identify(iso); err == nil {
+		t.Error("expected an error for a boot file that isn't an executable")
+	}
+}
+
+func TestIdentifyWrongSectors(t *testing.T) {
+	iso, err := testDisc(t).ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Move the GNS file, like a release with a different layout.
+	gns, err := findISOFile(iso, "MAP/MAP001.GNS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sector := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sector, uint32(gns.sector+1))
+	if _, err := iso.WriteAt(sector, gns.recordOffset+2); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Identify(iso)
+	if err == nil {
+		t.Fatal("expected an error for GNS files that aren't in the sector table")
+	}
+	if info.GNSSectors[testMapNum] != gns.sector+1 {
+		t.Errorf("GNS sector = %d, want %d", info.GNSSectors[testMapNum], gns.sector+1)
+	}
+}
+
+func TestReadISOFileBadSize(t *testing.T) {
+	iso, err := testDisc(t).ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cnf, err := findISOFile(iso, "SYSTEM.CNF")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bigger than any disc, and bigger than this image but small enough to
+	// fit on a disc.
+	for _, size := range []uint32{0xFFFFFFFF, uint32(100 * 1024 * 1024)} {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, size)
+		if _, err := iso.WriteAt(b, cnf.recordOffset+10); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readISOFile(iso, "SYSTEM.CNF"); err == nil {
+			t.Errorf("size %d: expected an error for a file past the end of the image", size)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// This file contains the ability to encode maps back into GNS data.
+//
+// It is the counterpart of map.go. A Map read with ReadMapRaw can be encoded
+// and the result read back into the same Map. Maps read with ReadMap can't be,
+// since their coordinates have been normalized.
+//
+// The sections we know how to read are encoded from the Map: the mesh, color
+// and gray palettes, lights and background, and terrain. The other sections,
+// like the animations, are written back as they were read. Triangles that
+// were split from a quad are written as a quad again, as long as the two
+// halves still have the shape of a split quad.
+package fft
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/adamrt/heretic"
+)
+
+// EncodeMesh encodes the map as a mesh file, the data a mesh record points to.
+// The coordinates must be FFT coordinates as returned by ReadMapRaw.
+func EncodeMesh(m Map) ([]byte, error) {
+	polys := groupPolygons(m.Mesh.Triangles)
+	for _, group := range [][]polygon{polys.texturedTris, polys.texturedQuads, polys.untexturedTris, polys.untexturedQuads} {
+		if len(group) > math.MaxUint16 {
+			return nil, fmt.Errorf("too many polygons: %d textured triangles, %d textured quads, %d untextured triangles, %d untextured quads",
+				len(polys.texturedTris), len(polys.texturedQuads), len(polys.untexturedTris), len(polys.untexturedQuads))
+		}
+	}
+
+	textured := append(append([]polygon{}, polys.texturedTris...), polys.texturedQuads...)
+	paletteIdxs := make([]int, len(textured))
+	for i, p := range textured {
+		idx, err := paletteIndex(m.Palettes, p[0].Palette, int(polygonSource(p[0]).CLUT&0b1111))
+		if err != nil {
+			return nil, fmt.Errorf("polygon %d: %w", i, err)
+		}
+		paletteIdxs[i] = idx
+	}
+
+	fileHeader := make(meshFileHeader, meshFileHeaderLen)
+	w := &dataWriter{}
+	w.writeBytes(fileHeader)
+
+	// Mesh data. The header pointer is set once everything is written.
+	fileHeader.setPtr(ptrPrimaryMesh, w.Len())
+	w.writeBytes(newMeshHeader(len(polys.texturedTris), len(polys.texturedQuads), len(polys.untexturedTris), len(polys.untexturedQuads)))
+	for _, group := range [][]polygon{polys.texturedTris, polys.texturedQuads, polys.untexturedTris, polys.untexturedQuads} {
+		for _, p := range group {
+			for _, v := range p.points() {
+				w.writeVertex(v)
+			}
+		}
+	}
+	for _, p := range textured {
+		for _, n := range p.normals() {
+			w.writeNormal(n)
+		}
+	}
+	for i, p := range textured {
+		if len(p) == 1 {
+			w.writeTriUV(p.texCoords(), paletteIdxs[i], p[0].BlendMode, polygonSource(p[0]))
+		} else {
+			w.writeQuadUV(p.texCoords(), paletteIdxs[i], p[0].BlendMode, polygonSource(p[0]))
+		}
+	}
+	for _, group := range [][]polygon{polys.untexturedTris, polys.untexturedQuads} {
+		for _, p := range group {
+			w.writeUntexturedData(p[0].Color, polygonSource(p[0]).Code)
+		}
+	}
+	for _, p := range textured {
+		w.writeTileLocation(p[0].Tile)
+	}
+	w.pad(4)
+
+	if len(m.Palettes) > 0 {
+		fileHeader.setPtr(ptrTexturePalettesColor, w.Len())
+		if err := writePalettes(w, m.Palettes); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.GrayPalettes) > 0 {
+		fileHeader.setPtr(ptrTexturePalettesGray, w.Len())
+		if err := writePalettes(w, m.GrayPalettes); err != nil {
+			return nil, fmt.Errorf("gray: %w", err)
+		}
+	}
+
+	if m.Mesh.Background != nil {
+		fileHeader.setPtr(ptrLightsAndBackground, w.Len())
+		w.writeDirectionalLights(m.Mesh.DirectionalLights)
+		w.writeRGB8(m.Mesh.AmbientLight.Color)
+		w.writeRGB8(m.Mesh.Background.Top)
+		w.writeRGB8(m.Mesh.Background.Bottom)
+		w.pad(4)
+	}
+
+	if m.Terrain.Width > 0 && m.Terrain.Depth > 0 {
+		fileHeader.setPtr(ptrTerrain, w.Len())
+		w.writeBytes(m.Terrain.encode())
+		w.pad(4)
+	}
+
+	// The sections that weren't parsed are copied as they are. Anything
+	// in them that points elsewhere in the file isn't updated.
+	for _, ptr := range unparsedPointers {
+		data, ok := m.unparsed[ptr]
+		if !ok {
+			continue
+		}
+		fileHeader.setPtr(ptr, w.Len())
+		w.writeBytes(data)
+		w.pad(4)
+	}
+
+	data := w.Bytes()
+	copy(data, fileHeader)
+	return data, nil
+}
+
+// EncodeTexture encodes a texture read by ReadMap back into the 4bpp format,
+// two palette indexes per byte.
+func EncodeTexture(t heretic.IndexedTexture) ([]byte, error) {
+	if t.Width() != textureWidth || t.Height() != textureHeight {
+		return nil, fmt.Errorf("texture must be %dx%d, got %dx%d", textureWidth, textureHeight, t.Width(), t.Height())
+	}
+	if t.BitsPerPixel() != 4 {
+		return nil, fmt.Errorf("texture must be 4bpp, got %dbpp", t.BitsPerPixel())
+	}
+	return append([]byte{}, t.Pix()...), nil
+}
+
+// writePalettes writes the 16 palettes of 16 colors.
+func writePalettes(w *dataWriter, palettes []heretic.Palette) error {
+	if len(palettes) != 16 {
+		return fmt.Errorf("expected 16 palettes, got %d", len(palettes))
+	}
+	for _, palette := range palettes {
+		if len(palette) != 16 {
+			return errors.New("expected 16 colors per palette")
+		}
+		for _, c := range palette {
+			w.writeRGB15(c)
+		}
+	}
+	return nil
+}
+
+// polygon is the triangle, or the two halves of a quad, that are written as a
+// single FFT polygon.
+type polygon []heretic.Triangle
+
+// polygons are the triangles of a mesh grouped the way the mesh data stores
+// them.
+type polygons struct {
+	texturedTris, texturedQuads     []polygon
+	untexturedTris, untexturedQuads []polygon
+}
+
+// groupPolygons groups the triangles into polygons. Consecutive triangles
+// that were split from the same quad are put back together.
+func groupPolygons(triangles []heretic.Triangle) polygons {
+	polys := polygons{}
+	for i := 0; i < len(triangles); i++ {
+		p := polygon{triangles[i]}
+		if i+1 < len(triangles) && isSplitQuad(triangles[i], triangles[i+1]) {
+			p = append(p, triangles[i+1])
+			i++
+		}
+		switch {
+		case p[0].Textured && len(p) == 1:
+			polys.texturedTris = append(polys.texturedTris, p)
+		case p[0].Textured:
+			polys.texturedQuads = append(polys.texturedQuads, p)
+		case len(p) == 1:
+			polys.untexturedTris = append(polys.untexturedTris, p)
+		default:
+			polys.untexturedQuads = append(polys.untexturedQuads, p)
+		}
+	}
+	return polys
+}
+
+// isSplitQuad reports whether the triangles are the two halves of a quad as
+// quad.split() makes them, with the same polygon data.
+func isSplitQuad(a, b heretic.Triangle) bool {
+	srcA, srcB := polygonSource(a), polygonSource(b)
+	if srcA.Quad != 1 || srcB.Quad != 2 || a.Textured != b.Textured {
+		return false
+	}
+	if a.Points[1] != b.Points[0] || a.Points[2] != b.Points[2] {
+		return false
+	}
+	if !a.Textured {
+		return a.Color == b.Color && srcA.Code == srcB.Code
+	}
+	return a.Texcoords[1] == b.Texcoords[0] && a.Texcoords[2] == b.Texcoords[2] &&
+		palettesEqual(a.Palette, b.Palette) && a.BlendMode == b.BlendMode &&
+		srcA.CLUT == srcB.CLUT && srcA.Texpage == srcB.Texpage &&
+		tilesEqual(a.Tile, b.Tile)
+}
+
+// points returns the points of the polygon in the order they are stored. It is
+// the inverse of quad.split() for quads.
+func (p polygon) points() []heretic.Vec3 {
+	if len(p) == 1 {
+		return p[0].Points[:3]
+	}
+	return []heretic.Vec3{p[0].Points[0], p[0].Points[1], p[0].Points[2], p[1].Points[1]}
+}
+
+// texCoords returns the texture coordinates in the order they are stored.
+func (p polygon) texCoords() []heretic.Tex {
+	if len(p) == 1 {
+		return p[0].Texcoords[:3]
+	}
+	return []heretic.Tex{p[0].Texcoords[0], p[0].Texcoords[1], p[0].Texcoords[2], p[1].Texcoords[1]}
+}
+
+// normals returns the vertex normals of the polygon. Triangles that weren't
+// read from a map don't have any, they get the face normal on every vertex.
+func (p polygon) normals() []heretic.Vec3 {
+	normals := make([][]heretic.Vec3, len(p))
+	for i, t := range p {
+		normals[i] = polygonSource(t).Normals
+		if len(normals[i]) != 3 {
+			n := triangleNormal(t)
+			normals[i] = []heretic.Vec3{n, n, n}
+		}
+	}
+	if len(p) == 1 {
+		return normals[0]
+	}
+	return []heretic.Vec3{normals[0][0], normals[0][1], normals[0][2], normals[1][1]}
+}
+
+func tilesEqual(a, b *heretic.TileLocation) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// polygonSource returns the FFT data the triangle was read with, or zero
+// values for triangles that weren't read from a map.
+func polygonSource(t heretic.Triangle) Polygon {
+	p, _ := t.Source.(Polygon)
+	return p
+}
+
+// triangleNormal returns the face normal of the triangle's points. It is used
+// for triangles without vertex normals, like those of edited meshes.
+func triangleNormal(t heretic.Triangle) heretic.Vec3 {
+	ab := t.Points[1].Sub(t.Points[0])
+	ac := t.Points[2].Sub(t.Points[0])
+	normal := ab.Cross(ac)
+	if normal.Length() == 0 {
+		return heretic.Vec3{}
+	}
+	return normal.Normalize()
+}
+
+// paletteIndex returns the index of the palette within palettes. Palettes are
+// compared by their colors, so any identical palette will do. The index the
+// polygon was read with is preferred, so maps with identical palettes are
+// written back the way they were read.
+func paletteIndex(palettes []heretic.Palette, palette heretic.Palette, preferred int) (int, error) {
+	if palette == nil {
+		return 0, nil
+	}
+	if preferred < len(palettes) && palettesEqual(palettes[preferred], palette) {
+		return preferred, nil
+	}
+	for i, p := range palettes {
+		if palettesEqual(p, palette) {
+			return i, nil
+		}
+	}
+	return 0, errors.New("palette is not one of the map palettes")
+}
+
+func palettesEqual(a, b heretic.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
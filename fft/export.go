@@ -0,0 +1,81 @@
+// This file contains a way to export a map as a Wavefront OBJ file.
+//
+// OBJ files have a single texture, but every FFT polygon picks one of 16
+// palettes for the same texture. The exported texture is the texture drawn
+// through each color palette side by side, and the texture coordinates of each
+// triangle are moved into the copy of its palette. Loading the OBJ with
+// heretic.NewMeshFromObj draws the same colors as the map.
+package fft
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/adamrt/heretic"
+)
+
+// ObjTexture returns the texture to save next to the OBJ written by WriteObj,
+// with the same name and a .png extension. It returns false if the map has no
+// texture.
+func ObjTexture(m Map) (*image.NRGBA, bool) {
+	texture, ok := m.Texture()
+	if !ok || len(m.Palettes) == 0 {
+		return nil, false
+	}
+	return TextureSheet(texture, m.Palettes), true
+}
+
+// WriteObj writes the triangles of the map as an OBJ file. Untextured
+// triangles are written without texture coordinates.
+func WriteObj(w io.Writer, m Map) error {
+	ew := &errWriter{w: w}
+	ew.printf("# %d triangles\n", len(m.Mesh.Triangles))
+
+	_, textured := ObjTexture(m)
+	v, vt, vn := 1, 1, 1
+	for i, t := range m.Mesh.Triangles {
+		for _, p := range t.Points {
+			ew.printf("v %g %g %g\n", p.X, p.Y, p.Z)
+		}
+
+		if !textured || !t.Textured {
+			ew.printf("f %d %d %d\n", v, v+1, v+2)
+			v += 3
+			continue
+		}
+
+		idx, err := paletteIndex(m.Palettes, t.Palette, int(polygonSource(t).CLUT&0b1111))
+		if err != nil {
+			return fmt.Errorf("triangle %d: %w", i, err)
+		}
+		for _, tex := range t.Texcoords {
+			uv := objTexcoord(tex, idx, len(m.Palettes))
+			ew.printf("vt %g %g\n", uv.U, uv.V)
+		}
+
+		// NewMeshFromObj only reads textured faces with normals.
+		a, b, c := t.Points[0], t.Points[1], t.Points[2]
+		n := b.Sub(a).Cross(c.Sub(a)).Normalize()
+		ew.printf("vn %g %g %g\n", n.X, n.Y, n.Z)
+		ew.printf("f %d/%d/%d %d/%d/%d %d/%d/%d\n", v, vt, vn, v+1, vt+1, vn, v+2, vt+2, vn)
+		v += 3
+		vt += 3
+		vn++
+	}
+	return ew.err
+}
+
+// objTexcoord moves a texture coordinate into the column of the palette in
+// the exported texture. processTexCoords divides by 255 and 1023, so the
+// coordinates are scaled back to pixels and then to the middle of the same
+// pixel of the wider texture. V is flipped since OBJ has its origin at the
+// bottom.
+func objTexcoord(t heretic.Tex, palette, palettes int) heretic.Tex {
+	u := (t.U*255 + 0.5) / float64(textureWidth)
+	v := (t.V*1023 + 0.5) / float64(textureHeight)
+	return heretic.Tex{
+		U: (float64(palette) + u) / float64(palettes),
+		V: 1 - v,
+	}
+}
@@ -0,0 +1,70 @@
+package fft
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adamrt/heretic"
+)
+
+func TestWriteObj(t *testing.T) {
+	m := testMap()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "map.obj")
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteObj(f, m); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	img, ok := ObjTexture(m)
+	if !ok {
+		t.Fatal("expected a texture")
+	}
+	f, err = os.Create(filepath.Join(dir, "map.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	obj := heretic.NewMeshFromObj(path)
+	if len(obj.Triangles) != len(m.Mesh.Triangles) {
+		t.Fatalf("got %d triangles, want %d", len(obj.Triangles), len(m.Mesh.Triangles))
+	}
+
+	// Every corner of a textured triangle samples the same color from the
+	// exported texture as from the map's texture through its palette.
+	texture, _ := m.Texture()
+	for i, want := range m.Mesh.Triangles {
+		got := obj.Triangles[i]
+		if got.Textured != want.Textured {
+			t.Fatalf("triangle %d: textured = %v, want %v", i, got.Textured, want.Textured)
+		}
+		if !want.Textured {
+			continue
+		}
+		for j := range want.Texcoords {
+			wx, wy := texelAt(texture, want.Texcoords[j])
+			wc, _ := texture.Sample(wx, wy, want.Palette)
+			gx, gy := texelAt(obj.Texture, got.Texcoords[j])
+			gc, _ := obj.Texture.Sample(gx, gy, nil)
+			if gc.NRGBA != wc.NRGBA {
+				t.Errorf("triangle %d corner %d: color = %v, want %v", i, j, gc.NRGBA, wc.NRGBA)
+			}
+		}
+	}
+}
+
+// texelAt returns the texel the rasterizer draws for the texture coordinate.
+func texelAt(s heretic.Sampler, t heretic.Tex) (int, int) {
+	return int(t.U*float64(s.Width())) % s.Width(), int(t.V*float64(s.Height())) % s.Height()
+}
@@ -0,0 +1,298 @@
+package fft
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/adamrt/heretic"
+)
+
+// Maps of the fixture disc. testMapNum has a map for the default state, a
+// night state and an override. testAltMapNum only has an alternate mesh, like
+// MAP002.
+const (
+	testMapNum    = 1
+	testAltMapNum = 2
+)
+
+var testNight = MapState{Time: TimeNight, Weather: WeatherNone}
+
+// testTex returns a texture coordinate the way readTriUV does.
+func testTex(u, v, page int) heretic.Tex {
+	return processTexCoords(heretic.Tex{U: float64(u), V: float64(v)}, page)
+}
+
+// testMap returns a map in FFT coordinates that uses every section the
+// encoder writes and every kind of polygon, in the order they are read. Every
+// value survives encoding exactly.
+func testMap() Map {
+	palettes := make([]heretic.Palette, 16)
+	for p := range palettes {
+		palettes[p] = make(heretic.Palette, 16)
+		for c := 1; c < 16; c++ {
+			palettes[p][c] = heretic.PaletteColor{
+				NRGBA: color.NRGBA{R: uint8(c * 8), G: uint8(p * 8), B: 64, A: 255},
+				STP:   p == 1,
+			}
+		}
+	}
+
+	// Indexes 0 to 15 repeating, two per byte.
+	pix := make([]byte, textureRawLen)
+	for i := range pix {
+		pix[i] = uint8(i*2%16) | uint8((i*2+1)%16)<<4
+	}
+
+	// A textured quad a, b, c, d and an untextured quad e, f, g, h, split
+	// the way the parser splits them.
+	qa, qb, qc, qd := heretic.Vec3{X: 56, Y: 0, Z: 0}, heretic.Vec3{X: 84, Y: 0, Z: 0}, heretic.Vec3{X: 56, Y: 0, Z: 28}, heretic.Vec3{X: 84, Y: -4, Z: 28}
+	ta, tb, tc, td := testTex(100, 0, 1), testTex(120, 0, 1), testTex(100, 20, 1), testTex(120, 20, 1)
+	na, nb, nc, nd := heretic.Vec3{X: 0, Y: 1, Z: 0}, heretic.Vec3{X: 0.25, Y: 0.5, Z: 0}, heretic.Vec3{X: 0, Y: 0.75, Z: -0.125}, heretic.Vec3{X: -1, Y: 0, Z: 0}
+	quadSource := Polygon{CLUT: 0x7802, Texpage: 0x0001}
+	qe, qf, qg, qh := heretic.Vec3{X: 0, Y: 48, Z: 0}, heretic.Vec3{X: 28, Y: 48, Z: 0}, heretic.Vec3{X: 0, Y: 48, Z: 28}, heretic.Vec3{X: 28, Y: 48, Z: 28}
+	brown := color.NRGBA{R: 120, G: 80, B: 40, A: 255}
+
+	return Map{
+		Mesh: heretic.Mesh{
+			Triangles: []heretic.Triangle{
+				{
+					Points:    []heretic.Vec3{{X: 0, Y: 0, Z: 0}, {X: 28, Y: 0, Z: 0}, {X: 0, Y: 0, Z: 28}},
+					Texcoords: []heretic.Tex{testTex(0, 0, 0), testTex(20, 0, 0), testTex(0, 20, 0)},
+					Textured:  true,
+					Palette:   palettes[0],
+					BlendMode: heretic.BlendModeOpaque,
+					Tile:      &heretic.TileLocation{X: 0, Z: 0, Level: 0},
+					// Mode bits without the semi-transparency flag.
+					Source: Polygon{CLUT: 0x7800, Texpage: 0x0060, Normals: []heretic.Vec3{na, nb, nc}},
+				},
+				{
+					Points:    []heretic.Vec3{{X: 28, Y: -12, Z: 28}, {X: 56, Y: -12, Z: 28}, {X: 28, Y: -12, Z: 56}},
+					Texcoords: []heretic.Tex{testTex(40, 200, 2), testTex(60, 200, 2), testTex(40, 220, 2)},
+					Textured:  true,
+					Palette:   palettes[1],
+					BlendMode: heretic.BlendModeAdd,
+					Tile:      &heretic.TileLocation{X: 1, Z: 2, Level: 1},
+					Source:    Polygon{CLUT: 0x7801, Texpage: texpageSemiTransparent | 0x0020 | 2, Normals: []heretic.Vec3{nd, nd, nd}},
+				},
+				{
+					// Not on any tile.
+					Points:    []heretic.Vec3{{X: 0, Y: -40, Z: 0}, {X: 28, Y: -40, Z: 0}, {X: 0, Y: -40, Z: 28}},
+					Texcoords: []heretic.Tex{testTex(0, 100, 3), testTex(20, 100, 3), testTex(0, 120, 3)},
+					Textured:  true,
+					Palette:   palettes[2],
+					Source:    Polygon{CLUT: 0x7802, Texpage: 0x0003, Normals: []heretic.Vec3{nc, nb, na}},
+				},
+				{
+					Points:    []heretic.Vec3{qa, qb, qc},
+					Texcoords: []heretic.Tex{ta, tb, tc},
+					Textured:  true,
+					Palette:   palettes[2],
+					Tile:      &heretic.TileLocation{X: 2, Z: 0, Level: 0},
+					Source:    Polygon{CLUT: quadSource.CLUT, Texpage: quadSource.Texpage, Normals: []heretic.Vec3{na, nb, nc}, Quad: 1},
+				},
+				{
+					Points:    []heretic.Vec3{qb, qd, qc},
+					Texcoords: []heretic.Tex{tb, td, tc},
+					Textured:  true,
+					Palette:   palettes[2],
+					Tile:      &heretic.TileLocation{X: 2, Z: 0, Level: 0},
+					Source:    Polygon{CLUT: quadSource.CLUT, Texpage: quadSource.Texpage, Normals: []heretic.Vec3{nb, nd, nc}, Quad: 2},
+				},
+				{
+					Points:    []heretic.Vec3{{X: 0, Y: 24, Z: 0}, {X: 0, Y: 24, Z: 28}, {X: 28, Y: 24, Z: 0}},
+					Texcoords: make([]heretic.Tex, 3),
+					Color:     color.NRGBA{R: 90, G: 60, B: 30, A: 255},
+					Source:    Polygon{Code: 0x20},
+				},
+				{
+					Points:    []heretic.Vec3{qe, qf, qg},
+					Texcoords: make([]heretic.Tex, 3),
+					Color:     brown,
+					Source:    Polygon{Code: 0x28, Quad: 1},
+				},
+				{
+					Points:    []heretic.Vec3{qf, qh, qg},
+					Texcoords: make([]heretic.Tex, 3),
+					Color:     brown,
+					Source:    Polygon{Code: 0x28, Quad: 2},
+				},
+			},
+			Texture: heretic.NewIndexedTexture(textureWidth, textureHeight, 4, pix, nil),
+			DirectionalLights: []heretic.DirectionalLight{
+				{Color: color.NRGBA{R: 255, G: 128, B: 0, A: 255}, Position: heretic.Vec3{X: 100, Y: -200, Z: 300}},
+				{Color: color.NRGBA{R: 10, G: 20, B: 30, A: 255}, Position: heretic.Vec3{X: -4096, Y: 0, Z: 0}},
+				{Color: color.NRGBA{R: 0, G: 0, B: 0, A: 255}, Position: heretic.Vec3{X: 0, Y: 4096, Z: 0}},
+			},
+			AmbientLight: heretic.AmbientLight{Color: color.NRGBA{R: 40, G: 50, B: 60, A: 255}},
+			Background: &heretic.Background{
+				Top:    color.NRGBA{R: 1, G: 2, B: 3, A: 255},
+				Bottom: color.NRGBA{R: 200, G: 150, B: 100, A: 255},
+			},
+			Scale: heretic.Vec3{X: 1, Y: 1, Z: 1},
+		},
+		Palettes:     palettes,
+		GrayPalettes: testGrayPalettes(),
+		Terrain: Terrain{
+			Width: 2,
+			Depth: 3,
+			Levels: [terrainLevels][]Tile{
+				{
+					{SurfaceType: 1, Height: 2},
+					{SurfaceType: 2, Height: 4, Depth: 1},
+					{SurfaceType: 3, Height: 6, SlopeHeight: 2, SlopeType: 0x85},
+					{SurfaceType: 0x3F, Height: 255, Depth: 7, SlopeHeight: 31, SlopeType: 0xFF},
+					{Impassable: true},
+					{Unselectable: true},
+				},
+				make([]Tile, 6),
+			},
+		},
+		unparsed: map[int32][]byte{
+			ptrTextureAnimInst:  {1, 2, 3, 4, 5, 6, 7, 8},
+			ptrVisibilityAngles: {9, 10, 11, 12},
+		},
+	}
+}
+
+// testGrayPalettes returns 16 palettes of shades of gray.
+func testGrayPalettes() []heretic.Palette {
+	palettes := make([]heretic.Palette, 16)
+	for p := range palettes {
+		palettes[p] = make(heretic.Palette, 16)
+		for c := 1; c < 16; c++ {
+			v := uint8(c*16 + p)
+			v -= v % 8
+			palettes[p][c] = heretic.PaletteColor{NRGBA: color.NRGBA{R: v, G: v, B: v, A: 255}}
+		}
+	}
+	return palettes
+}
+
+// testNightMap is testMap with different lights, so it can be told apart.
+func testNightMap() Map {
+	m := testMap()
+	m.Mesh.AmbientLight.Color = color.NRGBA{R: 0, G: 0, B: 90, A: 255}
+	return m
+}
+
+// testOverride returns an override mesh that only replaces the terrain.
+func testOverride(t *testing.T) []byte {
+	t.Helper()
+	m := Map{Terrain: testMap().Terrain}
+	m.Terrain.Levels[0] = append([]Tile{}, m.Terrain.Levels[0]...)
+	m.Terrain.Levels[0][0].Height = 99
+
+	data, err := EncodeMesh(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// EncodeMesh always writes a mesh, overrides usually don't have one.
+	meshFileHeader(data).setPtr(ptrPrimaryMesh, 0)
+	return data
+}
+
+// testDisc returns the fixture disc used by the tests.
+func testDisc(t *testing.T) *fixtureDisc {
+	t.Helper()
+	disc := newFixtureDisc()
+	if err := disc.AddMap(testMapNum, DefaultMapState, testMap()); err != nil {
+		t.Fatal(err)
+	}
+	if err := disc.AddMap(testMapNum, testNight, testNightMap()); err != nil {
+		t.Fatal(err)
+	}
+	disc.AddResource(testMapNum, RecordTypeMeshOverride, testNight, testOverride(t))
+
+	alt, err := EncodeMesh(testMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	disc.AddResource(testAltMapNum, RecordTypeMeshAlt, DefaultMapState, alt)
+	return disc
+}
+
+// testImages returns the fixture disc as both an ISO and a BIN image.
+func testImages(t *testing.T) map[string]WritableImage {
+	t.Helper()
+	disc := testDisc(t)
+	iso, err := disc.ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := disc.BIN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]WritableImage{"iso": iso, "bin": bin}
+}
+
+func testReader(t *testing.T, image WritableImage) MeshReader {
+	t.Helper()
+	iso, err := NewISOReaderAt(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMeshReader(iso)
+}
+
+func TestFixtureIdentify(t *testing.T) {
+	for name, image := range testImages(t) {
+		t.Run(name, func(t *testing.T) {
+			info, err := Identify(newDiscImage(image))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Version != DiscUS {
+				t.Errorf("version = %v, want DiscUS", info.Version)
+			}
+			if info.VolumeID != "FFT_FIXTURE" {
+				t.Errorf("volume ID = %q", info.VolumeID)
+			}
+			if info.Executable != DiscUS.Executable {
+				t.Errorf("executable = %q", info.Executable)
+			}
+		})
+	}
+}
+
+func TestFixtureUnknownDisc(t *testing.T) {
+	disc := newFixtureDisc()
+	disc.Executable = nil
+	iso, err := disc.ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the BOOT line so the executable isn't found.
+	cnf, err := findISOFile(iso, "SYSTEM.CNF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := iso.WriteAt([]byte("BOOT = cdrom:\\SLPS_000.00;1"), cnf.sector*sectorSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewISOReaderAt(iso); err == nil {
+		t.Error("expected an error for an unknown disc")
+	}
+}
+
+func TestFixtureBINSectors(t *testing.T) {
+	bin, err := testDisc(t).BIN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := make([]byte, rawSectorSize)
+	if _, err := bin.ReadAt(raw, pvdSector*rawSectorSize); err != nil {
+		t.Fatal(err)
+	}
+	// 16 + 150 = 166 frames = 00:02:16
+	if raw[12] != 0x00 || raw[13] != 0x02 || raw[14] != 0x16 || raw[15] != 2 {
+		t.Errorf("header = % x", raw[12:16])
+	}
+
+	check := make([]byte, rawSectorSize)
+	copy(check, raw)
+	sectorEDCECC(check)
+	if string(check) != string(raw) {
+		t.Error("EDC/ECC changed when recomputed")
+	}
+}
@@ -0,0 +1,431 @@
+// This file contains a way to build small synthetic disc images for tests.
+//
+// Real FFT discs are copyrighted, so tests can't ship with one. A fixture disc
+// has the same structure as the real thing: an ISO9660 file system with
+// SYSTEM.CNF, the boot executable of DiscUS and a MAP directory whose GNS
+// files are at the sectors of DiscUS. Only the maps are made up.
+//
+// The images are sparse. Only sectors that contain data are kept in memory,
+// so a map near the end of the disc doesn't need a buffer the size of the
+// disc.
+package fft
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// fixtureDisc builds a synthetic disc image. Maps are added to it and then
+// the image is built with ISO or BIN.
+type fixtureDisc struct {
+	// VolumeID is the volume ID of the primary volume descriptor.
+	VolumeID string
+
+	// Executable is the contents of the boot executable.
+	Executable []byte
+
+	maps map[int][]fixtureResource
+}
+
+type fixtureResource struct {
+	typ   RecordType
+	state MapState
+	data  []byte
+}
+
+// newFixtureDisc returns an empty disc. Once it has a map, Identify detects it
+// as DiscUS.
+func newFixtureDisc() *fixtureDisc {
+	return &fixtureDisc{
+		VolumeID:   "FFT_FIXTURE",
+		Executable: []byte("PS-X EXE"),
+		maps:       map[int][]fixtureResource{},
+	}
+}
+
+// AddResource adds a resource file to the map along with a GNS record of the
+// type and state that points to it. Records are written in the order they are
+// added.
+func (d *fixtureDisc) AddResource(mapNum int, typ RecordType, state MapState, data []byte) {
+	d.maps[mapNum] = append(d.maps[mapNum], fixtureResource{typ: typ, state: state, data: data})
+}
+
+// AddMap encodes the map and adds it as a primary mesh record for the state.
+// A texture record is added too if the map has a texture.
+func (d *fixtureDisc) AddMap(mapNum int, state MapState, m Map) error {
+	mesh, err := EncodeMesh(m)
+	if err != nil {
+		return err
+	}
+	d.AddResource(mapNum, RecordTypeMeshPrimary, state, mesh)
+
+	if m.Mesh.Texture == nil {
+		return nil
+	}
+	indexed, ok := m.Texture()
+	if !ok {
+		return fmt.Errorf("texture is %T, not an indexed texture", m.Mesh.Texture)
+	}
+	texture, err := EncodeTexture(indexed)
+	if err != nil {
+		return err
+	}
+	d.AddResource(mapNum, RecordTypeTexture, state, texture)
+	return nil
+}
+
+// MapFiles returns the files of the MAP directory by name, as they would be
+// extracted from the disc. They can be written out to test DirSource.
+func (d *fixtureDisc) MapFiles() (map[string][]byte, error) {
+	files, err := d.mapFiles()
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string][]byte{}
+	for _, f := range files {
+		byName[f.name] = f.data
+	}
+	return byName, nil
+}
+
+// ISO builds an image with 2048 byte sectors.
+func (d *fixtureDisc) ISO() (WritableImage, error) {
+	image := newSparseImage(sectorSize)
+	if err := d.write(image); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// BIN builds a raw image with 2352 byte mode 2 form 1 sectors, including
+// valid EDC/ECC.
+func (d *fixtureDisc) BIN() (WritableImage, error) {
+	iso := newSparseImage(sectorSize)
+	if err := d.write(iso); err != nil {
+		return nil, err
+	}
+
+	// The first sector is always written since the sync pattern is how raw
+	// images are detected.
+	if _, ok := iso.sectors[0]; !ok {
+		iso.sectors[0] = make([]byte, sectorSize)
+	}
+
+	bin := newSparseImage(rawSectorSize)
+	for sector, data := range iso.sectors {
+		raw := make([]byte, rawSectorSize)
+		copy(raw, rawSync)
+		copy(raw[12:15], sectorMSF(sector))
+		raw[15] = 2                                      // mode
+		copy(raw[16:24], []byte{0, 0, 8, 0, 0, 0, 8, 0}) // subheader: data, form 1
+		copy(raw[rawDataOffset:], data)
+		sectorEDCECC(raw)
+		bin.sectors[sector] = raw
+	}
+	bin.size = iso.size / sectorSize * rawSectorSize
+	return bin, nil
+}
+
+// sectorMSF returns the BCD minute/second/frame address of a sector. Sector
+// zero is at 00:02:00 because of the two second lead-in.
+func sectorMSF(sector int64) []byte {
+	bcd := func(v int64) byte { return byte(v/10<<4 | v%10) }
+	lba := sector + 150
+	return []byte{bcd(lba / 75 / 60), bcd(lba / 75 % 60), bcd(lba % 75)}
+}
+
+// fixtureFile is a file in the MAP directory.
+type fixtureFile struct {
+	name   string
+	sector int64
+	data   []byte
+}
+
+// mapFiles lays out the files of every map. The GNS file is at the sector of
+// DiscUS and the resource files follow it, like on the real disc.
+func (d *fixtureDisc) mapFiles() ([]fixtureFile, error) {
+	nums := make([]int, 0, len(d.maps))
+	for num := range d.maps {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	files := []fixtureFile{}
+	for _, num := range nums {
+		gnsSec, err := gnsSector(DiscUS, num)
+		if err != nil {
+			return nil, err
+		}
+		resources := d.maps[num]
+
+		gnsLen := int64((len(resources) + 1) * GNSRecordLen)
+		sector := gnsSec + sectorCount(gnsLen)
+		records := []GNSRecord{}
+		for i, res := range resources {
+			record, err := NewGNSRecord(res.typ, res.state, sector, int64(len(res.data)))
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+			files = append(files, fixtureFile{
+				name:   fmt.Sprintf("MAP%03d.%d", num, i+1),
+				sector: sector,
+				data:   res.data,
+			})
+			sector += sectorCount(int64(len(res.data)))
+		}
+		files = append(files, fixtureFile{
+			name:   fmt.Sprintf("MAP%03d.GNS", num),
+			sector: gnsSec,
+			data:   EncodeGNS(records),
+		})
+
+		if next := nextGNSSector(gnsSec); next != 0 && sector > next {
+			return nil, fmt.Errorf("map %d is too big, it runs into the next map at sector %d", num, next)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].sector < files[j].sector })
+	return files, nil
+}
+
+// nextGNSSector returns the first GNS sector of DiscUS after the sector, or
+// zero if it is the last.
+func nextGNSSector(sector int64) int64 {
+	var next int64
+	for _, s := range DiscUS.GNSSectors {
+		if s > sector && (next == 0 || s < next) {
+			next = s
+		}
+	}
+	return next
+}
+
+// Sectors of the file system. The MAP directory takes as many sectors as it
+// needs and the other files come after it.
+const (
+	fixtureTerminatorSector = pvdSector + 1
+	fixtureRootSector       = pvdSector + 2
+	fixtureMapDirSector     = pvdSector + 3
+)
+
+func (d *fixtureDisc) write(image *sparseImage) error {
+	files, err := d.mapFiles()
+	if err != nil {
+		return err
+	}
+
+	mapDirEntries := []fixtureDirEntry{}
+	for _, f := range files {
+		mapDirEntries = append(mapDirEntries, fixtureDirEntry{name: f.name + ";1", sector: f.sector, size: int64(len(f.data))})
+	}
+	// The size of a directory doesn't depend on the sectors in it, so it
+	// can be laid out before they are known.
+	mapDirSize := int64(len(encodeDirectory(0, 0, 0, 0, mapDirEntries)))
+
+	cnfSector := fixtureMapDirSector + sectorCount(mapDirSize)
+	cnf := []byte("BOOT = cdrom:\\" + DiscUS.Executable + ";1\r\nTCB = 4\r\nEVENT = 10\r\nSTACK = 801FFFF0\r\n")
+	exeSector := cnfSector + sectorCount(int64(len(cnf)))
+	if len(files) > 0 && exeSector+sectorCount(int64(len(d.Executable))) > files[0].sector {
+		return fmt.Errorf("executable runs into the first map")
+	}
+
+	rootEntries := []fixtureDirEntry{
+		{name: "MAP", sector: fixtureMapDirSector, size: mapDirSize, isDir: true},
+		{name: "SYSTEM.CNF;1", sector: cnfSector, size: int64(len(cnf))},
+		{name: DiscUS.Executable + ";1", sector: exeSector, size: int64(len(d.Executable))},
+	}
+	rootSize := int64(len(encodeDirectory(0, 0, 0, 0, rootEntries)))
+	if rootSize > sectorSize {
+		return fmt.Errorf("root directory is too big")
+	}
+
+	// The volume ends after the last file.
+	end := exeSector + sectorCount(int64(len(d.Executable)))
+	if len(files) > 0 {
+		last := files[len(files)-1]
+		end = last.sector + sectorCount(int64(len(last.data)))
+	}
+
+	writes := []struct {
+		sector int64
+		data   []byte
+	}{
+		{pvdSector, d.pvd(end, rootSize)},
+		{fixtureTerminatorSector, terminatorDescriptor()},
+		{fixtureRootSector, encodeDirectory(fixtureRootSector, rootSize, fixtureRootSector, rootSize, rootEntries)},
+		{fixtureMapDirSector, encodeDirectory(fixtureMapDirSector, mapDirSize, fixtureRootSector, rootSize, mapDirEntries)},
+		{cnfSector, cnf},
+		{exeSector, d.Executable},
+	}
+	for _, f := range files {
+		writes = append(writes, struct {
+			sector int64
+			data   []byte
+		}{f.sector, f.data})
+	}
+
+	for _, w := range writes {
+		// Files take up whole sectors, the rest of the last one is zero.
+		data := make([]byte, sectorCount(int64(len(w.data)))*sectorSize)
+		copy(data, w.data)
+		if _, err := image.WriteAt(data, w.sector*sectorSize); err != nil {
+			return err
+		}
+	}
+	image.size = end * sectorSize
+	return nil
+}
+
+// pvd returns the primary volume descriptor. Only the fields Identify and
+// findISOFile read, and the ones other tools need to mount the image, are
+// set.
+func (d *fixtureDisc) pvd(volumeSectors int64, rootSize int64) []byte {
+	pvd := make([]byte, sectorSize)
+	pvd[0] = 1
+	copy(pvd[1:6], "CD001")
+	pvd[6] = 1
+	copy(pvd[8:40], padRight("PLAYSTATION", 32))
+	copy(pvd[pvdVolumeID:pvdVolumeID+32], padRight(d.VolumeID, 32))
+	putBothEndian32(pvd[80:88], uint32(volumeSectors))
+	putBothEndian16(pvd[120:124], 1) // volume set size
+	putBothEndian16(pvd[124:128], 1) // volume sequence number
+	putBothEndian16(pvd[128:132], uint16(sectorSize))
+	copy(pvd[pvdRootRecord:], encodeDirRecord("\x00", fixtureRootSector, rootSize, true))
+	pvd[881] = 1 // file structure version
+	return pvd
+}
+
+func terminatorDescriptor() []byte {
+	t := make([]byte, sectorSize)
+	t[0] = 255
+	copy(t[1:6], "CD001")
+	t[6] = 1
+	return t
+}
+
+type fixtureDirEntry struct {
+	name   string
+	sector int64
+	size   int64
+	isDir  bool
+}
+
+// encodeDirectory returns the directory records of a directory, starting
+// with the "." and ".." entries. Records don't cross sector boundaries, so the
+// directory is padded to whole sectors.
+func encodeDirectory(sector, size, parentSector, parentSize int64, entries []fixtureDirEntry) []byte {
+	records := [][]byte{
+		encodeDirRecord("\x00", sector, size, true),
+		encodeDirRecord("\x01", parentSector, parentSize, true),
+	}
+	for _, e := range entries {
+		records = append(records, encodeDirRecord(e.name, e.sector, e.size, e.isDir))
+	}
+
+	dir := []byte{}
+	used := int64(0)
+	for _, r := range records {
+		if used+int64(len(r)) > sectorSize {
+			dir = append(dir, make([]byte, sectorSize-used)...)
+			used = 0
+		}
+		dir = append(dir, r...)
+		used += int64(len(r))
+	}
+	return append(dir, make([]byte, sectorSize-used)...)
+}
+
+// encodeDirRecord returns a single directory record. Records are padded to an
+// even length.
+func encodeDirRecord(name string, sector, size int64, isDir bool) []byte {
+	length := dirRecordMinLen + len(name)
+	if length%2 == 1 {
+		length++
+	}
+	r := make([]byte, length)
+	r[0] = byte(length)
+	putBothEndian32(r[2:10], uint32(sector))
+	putBothEndian32(r[10:18], uint32(size))
+	if isDir {
+		r[25] = 0b10
+	}
+	putBothEndian16(r[28:32], 1) // volume sequence number
+	r[32] = byte(len(name))
+	copy(r[33:], name)
+	return r
+}
+
+// ISO9660 stores most numbers twice, little endian and then big endian.
+func putBothEndian32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b[0:4], v)
+	binary.BigEndian.PutUint32(b[4:8], v)
+}
+
+func putBothEndian16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b[0:2], v)
+	binary.BigEndian.PutUint16(b[2:4], v)
+}
+
+func padRight(s string, n int) string {
+	if len(s) >= n {
+		return s[:n]
+	}
+	return s + strings.Repeat(" ", n-len(s))
+}
+
+// sparseImage is an in-memory image that only stores sectors that have been
+// written to. Sectors that haven't been written read as zeros.
+type sparseImage struct {
+	sectorLen int64
+	sectors   map[int64][]byte
+	size      int64
+}
+
+func newSparseImage(sectorLen int64) *sparseImage {
+	return &sparseImage{sectorLen: sectorLen, sectors: map[int64][]byte{}}
+}
+
+func (s *sparseImage) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= s.size {
+			return n, io.EOF
+		}
+		sector, within := pos/s.sectorLen, pos%s.sectorLen
+		chunk := p[n:min64(min64(int64(len(p)), int64(n)+s.sectorLen-within), s.size-off)]
+		if data, ok := s.sectors[sector]; ok {
+			copy(chunk, data[within:])
+		} else {
+			for i := range chunk {
+				chunk[i] = 0
+			}
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+func (s *sparseImage) WriteAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		sector, within := pos/s.sectorLen, pos%s.sectorLen
+		chunk := p[n:min64(int64(len(p)), int64(n)+s.sectorLen-within)]
+		data, ok := s.sectors[sector]
+		if !ok {
+			data = make([]byte, s.sectorLen)
+			s.sectors[sector] = data
+		}
+		copy(data[within:], chunk)
+		n += len(chunk)
+	}
+	if end := off + int64(len(p)); end > s.size {
+		s.size = end
+	}
+	return n, nil
+}
@@ -11,6 +11,8 @@ package fft
 
 import (
 	"encoding/binary"
+	"fmt"
+	"math"
 )
 
 type RecordType int
@@ -23,6 +25,22 @@ const (
 	RecordTypeEnd          RecordType = 0x3101
 )
 
+func (t RecordType) String() string {
+	switch t {
+	case RecordTypeTexture:
+		return "texture"
+	case RecordTypeMeshPrimary:
+		return "mesh primary"
+	case RecordTypeMeshOverride:
+		return "mesh override"
+	case RecordTypeMeshAlt:
+		return "mesh alt"
+	case RecordTypeEnd:
+		return "end"
+	}
+	return fmt.Sprintf("unknown(%#x)", int(t))
+}
+
 type MapWeather int
 
 const (
@@ -33,6 +51,20 @@ const (
 	WeatherVeryStrong MapWeather = 0x4
 )
 
+func (w MapWeather) String() string {
+	switch w {
+	case WeatherNone, WeatherNoneAlt:
+		return "none"
+	case WeatherNormal:
+		return "normal"
+	case WeatherStrong:
+		return "strong"
+	case WeatherVeryStrong:
+		return "very strong"
+	}
+	return fmt.Sprintf("unknown(%d)", int(w))
+}
+
 type MapTime int8
 
 const (
@@ -40,10 +72,105 @@ const (
 	TimeNight MapTime = 0x1
 )
 
+func (t MapTime) String() string {
+	if t == TimeNight {
+		return "night"
+	}
+	return "day"
+}
+
+// MapState is a combination of time and weather. A map can provide different
+// textures and mesh records for each state it supports.
+type MapState struct {
+	Time    MapTime
+	Weather MapWeather
+}
+
+// DefaultMapState is the state every map provides. It is also used as the
+// fallback when a map doesn't have records for a requested state.
+var DefaultMapState = MapState{Time: TimeDay, Weather: WeatherNone}
+
+func (s MapState) String() string {
+	return fmt.Sprintf("%s/%s", s.Time, s.Weather)
+}
+
+// normalize folds WeatherNoneAlt into WeatherNone. They both mean there is no
+// weather, so records with either should match the same state.
+func (s MapState) normalize() MapState {
+	if s.Weather == WeatherNoneAlt {
+		s.Weather = WeatherNone
+	}
+	return s
+}
+
+// less orders states by time and then weather, so day comes before night and
+// calm weather comes before strong weather.
+func (s MapState) less(o MapState) bool {
+	if s.Time != o.Time {
+		return s.Time < o.Time
+	}
+	return s.Weather < o.Weather
+}
+
 type GNSRecord []byte
 
 const GNSRecordLen = 20
 
+// NewGNSRecord returns a record of the type and state that points to length
+// bytes at the sector. The bytes we don't know the meaning of are zero. An
+// error is returned if the sector or length doesn't fit in the record.
+func NewGNSRecord(typ RecordType, state MapState, sector int64, length int64) (GNSRecord, error) {
+	r := make(GNSRecord, GNSRecordLen)
+	r[3] = uint8(state.Time&0x1)<<7 | uint8(state.Weather&0x7)<<4
+	binary.LittleEndian.PutUint16(r[4:6], uint16(typ))
+	if err := r.SetLocation(sector, length); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetLocation changes where the record points to. The sector is 16 bits and
+// the length 32 bits. An error is returned, and the record isn't changed, if
+// either doesn't fit.
+func (r GNSRecord) SetLocation(sector int64, length int64) error {
+	if sector < 0 || sector > math.MaxUint16 {
+		return fmt.Errorf("gns record: sector %d doesn't fit in 16 bits", sector)
+	}
+	if length < 0 || length > math.MaxUint32 {
+		return fmt.Errorf("gns record: length %d doesn't fit in 32 bits", length)
+	}
+	binary.LittleEndian.PutUint16(r[8:10], uint16(sector))
+	binary.LittleEndian.PutUint32(r[12:16], uint32(length))
+	return nil
+}
+
+// EncodeGNS returns the contents of a GNS file with the records, followed by
+// the end record.
+func EncodeGNS(records []GNSRecord) []byte {
+	data := make([]byte, 0, (len(records)+1)*GNSRecordLen)
+	for _, r := range records {
+		data = append(data, r...)
+	}
+	end := make(GNSRecord, GNSRecordLen)
+	binary.LittleEndian.PutUint16(end[4:6], uint16(RecordTypeEnd))
+	return append(data, end...)
+}
+
+// ParseGNS parses the records of a GNS file up to the end record. The loop is
+// bounded by the data, an error is returned if there is no end record in it.
+func ParseGNS(data []byte) ([]GNSRecord, error) {
+	records := []GNSRecord{}
+	for off := 0; off+GNSRecordLen <= len(data); off += GNSRecordLen {
+		// Copy so changing a record doesn't change the data.
+		record := append(GNSRecord{}, data[off:off+GNSRecordLen]...)
+		if record.Type() == RecordTypeEnd {
+			return records, nil
+		}
+		records = append(records, record)
+	}
+	return nil, fmt.Errorf("no end record in %d bytes of gns data", len(data))
+}
+
 func (r GNSRecord) Sector() int64 {
 	return int64(binary.LittleEndian.Uint16(r[8:10]))
 }
@@ -64,6 +191,13 @@ func (r GNSRecord) Weather() MapWeather {
 	return MapWeather(int((r[3] >> 4) & 0x7))
 }
 
+// State returns the normalized time and weather of the record.
+func (r GNSRecord) State() MapState {
+	return MapState{Time: r.Time(), Weather: r.Weather()}.normalize()
+}
+
+// GNSSectors are the sectors of each map's GNS file on the North American disc.
+// Use DiscVersion.GNSSectors to support other releases.
 var GNSSectors = [126]int64{
 	10026, // MAP000.GNS
 	11304, // MAP001.GNS
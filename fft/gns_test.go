@@ -0,0 +1,76 @@
+package fft
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGNS(t *testing.T) {
+	records := []GNSRecord{
+		newTestGNSRecord(t, RecordTypeMeshPrimary, DefaultMapState, 100, 2000),
+		newTestGNSRecord(t, RecordTypeTexture, testNight, 101, int64(textureRawLen)),
+	}
+	data := EncodeGNS(records)
+
+	got, err := ParseGNS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("records = %v, want %v", got, records)
+	}
+
+	// Changing a parsed record doesn't change the data.
+	if err := got[0].SetLocation(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := ParseGNS(data); again[0].Sector() != 100 {
+		t.Error("parsed records share memory with the data")
+	}
+
+	if _, err := ParseGNS(data[:len(data)-GNSRecordLen]); err == nil {
+		t.Error("expected an error without an end record")
+	}
+	if _, err := ParseGNS(data[:len(data)-1]); err == nil {
+		t.Error("expected an error with a partial end record")
+	}
+}
+
+func TestGNSRecordLocationRange(t *testing.T) {
+	r := newTestGNSRecord(t, RecordTypeMeshPrimary, DefaultMapState, 100, 2000)
+	for _, loc := range []struct{ sector, length int64 }{
+		{1 << 16, 2000},
+		{-1, 2000},
+		{100, 1 << 32},
+	} {
+		if err := r.SetLocation(loc.sector, loc.length); err == nil {
+			t.Errorf("SetLocation(%d, %d) succeeded, want an error", loc.sector, loc.length)
+		}
+	}
+	if r.Sector() != 100 || r.Len() != 2000 {
+		t.Errorf("record changed to sector %d, length %d", r.Sector(), r.Len())
+	}
+	if _, err := NewGNSRecord(RecordTypeMeshPrimary, DefaultMapState, 1<<16, 1); err == nil {
+		t.Error("NewGNSRecord succeeded with a sector past 16 bits")
+	}
+}
+
+func newTestGNSRecord(t testing.TB, typ RecordType, state MapState, sector, length int64) GNSRecord {
+	t.Helper()
+	r, err := NewGNSRecord(typ, state, sector, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func FuzzParseGNS(f *testing.F) {
+	f.Add(EncodeGNS([]GNSRecord{newTestGNSRecord(f, RecordTypeMeshPrimary, DefaultMapState, 100, 2000)}))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		records, err := ParseGNS(data)
+		if err == nil && len(records)*GNSRecordLen >= len(data) {
+			t.Errorf("%d records from %d bytes", len(records), len(data))
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package fft
+
+import (
+	"bytes"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"github.com/adamrt/heretic"
+)
+
+// handmadeMesh is a mesh file written byte by byte, with one polygon of each
+// kind. It doesn't come from EncodeMesh, so parsing it checks the reader
+// against the format rather than against the writer.
+func handmadeMesh() []byte {
+	header := make([]byte, meshFileHeaderLen)
+	header[0x40] = 0xc4 // primary mesh at 196
+	header[0x44] = 0x6c // palettes at 364
+	header[0x45] = 0x01
+
+	polygons := []byte{
+		// N=1 P=1 Q=1 R=1
+		0x01, 0x00, 0x01, 0x00, 0x01, 0x00, 0x01, 0x00,
+
+		// Textured triangle (10,-20,30) (40,0,0) (0,0,50)
+		0x0a, 0x00, 0xec, 0xff, 0x1e, 0x00,
+		0x28, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x32, 0x00,
+		// Textured quad (0,0,0) (28,0,0) (0,0,28) (28,-4,28)
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x1c, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x1c, 0x00,
+		0x1c, 0x00, 0xfc, 0xff, 0x1c, 0x00,
+		// Untextured triangle (1,1,1) (2,2,2) (3,3,3)
+		0x01, 0x00, 0x01, 0x00, 0x01, 0x00,
+		0x02, 0x00, 0x02, 0x00, 0x02, 0x00,
+		0x03, 0x00, 0x03, 0x00, 0x03, 0x00,
+		// Untextured quad (0,8,0) (8,8,0) (0,8,8) (8,8,8)
+		0x00, 0x00, 0x08, 0x00, 0x00, 0x00,
+		0x08, 0x00, 0x08, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x08, 0x00, 0x08, 0x00,
+		0x08, 0x00, 0x08, 0x00, 0x08, 0x00,
+
+		// Triangle normals, (0,-1,0) three times
+		0x00, 0x00, 0x00, 0xf0, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0xf0, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0xf0, 0x00, 0x00,
+		// Quad normals (1,0,0) (0,0,1) (-1,0,0) (0,0,-0.5)
+		0x00, 0x10, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x10,
+		0x00, 0xf0, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0xf8,
+
+		// Triangle UVs (0,0) (20,0) (0,20), palette 3, page 1, opaque
+		// with mode bits 1
+		0x00, 0x00, 0x03, 0x78,
+		0x14, 0x00, 0x21, 0x00,
+		0x00, 0x14,
+		// Quad UVs (100,10) (120,10) (100,30) (120,30), palette 5, page
+		// 2, semi-transparent with mode 0
+		0x64, 0x0a, 0x05, 0x78,
+		0x78, 0x0a, 0x02, 0x02,
+		0x64, 0x1e,
+		0x78, 0x1e,
+
+		// Untextured triangle red, quad green
+		0xff, 0x00, 0x00, 0x20,
+		0x00, 0xff, 0x00, 0x28,
+
+		// Triangle on tile X=5 Z=3 on the upper level, quad on no tile
+		0x07, 0x05,
+		0xff, 0xff,
+	}
+
+	// 16 palettes of transparent colors.
+	palettes := make([]byte, palettesLen)
+
+	data := append(header, polygons...)
+	return append(data, palettes...)
+}
+
+// handmadeTex is a texture coordinate on a page, normalized the way
+// processTexCoords does it.
+func handmadeTex(u, v, page float64) heretic.Tex {
+	return heretic.Tex{U: u / 255, V: (v + page*256) / 1023}
+}
+
+func TestParseHandmadeMesh(t *testing.T) {
+	m, err := ParseMesh(handmadeMesh())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type triangle struct {
+		points    []heretic.Vec3
+		texcoords []heretic.Tex
+		blendMode heretic.BlendMode
+		color     color.NRGBA
+		tile      *heretic.TileLocation
+		source    Polygon
+	}
+	down := heretic.Vec3{X: 0, Y: 1, Z: 0}
+	n1, n2, n3, n4 := heretic.Vec3{X: 1}, heretic.Vec3{Z: 1}, heretic.Vec3{X: -1}, heretic.Vec3{Z: -0.5}
+	qa, qb, qc, qd := heretic.Vec3{}, heretic.Vec3{X: 28}, heretic.Vec3{Z: 28}, heretic.Vec3{X: 28, Y: 4, Z: 28}
+	ta, tb, tc, td := handmadeTex(100, 10, 2), handmadeTex(120, 10, 2), handmadeTex(100, 30, 2), handmadeTex(120, 30, 2)
+	ua, ub, uc, ud := heretic.Vec3{Y: -8}, heretic.Vec3{X: 8, Y: -8}, heretic.Vec3{Y: -8, Z: 8}, heretic.Vec3{X: 8, Y: -8, Z: 8}
+	red := color.NRGBA{R: 255, A: 255}
+	green := color.NRGBA{G: 255, A: 255}
+	none := make([]heretic.Tex, 3)
+
+	want := []triangle{
+		{
+			points:    []heretic.Vec3{{X: 10, Y: 20, Z: 30}, {X: 40}, {Z: 50}},
+			texcoords: []heretic.Tex{handmadeTex(0, 0, 1), handmadeTex(20, 0, 1), handmadeTex(0, 20, 1)},
+			tile:      &heretic.TileLocation{X: 5, Z: 3, Level: 1},
+			source:    Polygon{CLUT: 0x7803, Texpage: 0x0021, Normals: []heretic.Vec3{down, down, down}},
+		},
+		{
+			points:    []heretic.Vec3{qa, qb, qc},
+			texcoords: []heretic.Tex{ta, tb, tc},
+			blendMode: heretic.BlendModeAverage,
+			source:    Polygon{CLUT: 0x7805, Texpage: 0x0202, Normals: []heretic.Vec3{n1, n2, n3}, Quad: 1},
+		},
+		{
+			points:    []heretic.Vec3{qb, qd, qc},
+			texcoords: []heretic.Tex{tb, td, tc},
+			blendMode: heretic.BlendModeAverage,
+			source:    Polygon{CLUT: 0x7805, Texpage: 0x0202, Normals: []heretic.Vec3{n2, n4, n3}, Quad: 2},
+		},
+		{
+			points:    []heretic.Vec3{{X: 1, Y: -1, Z: 1}, {X: 2, Y: -2, Z: 2}, {X: 3, Y: -3, Z: 3}},
+			texcoords: none,
+			color:     red,
+			source:    Polygon{Code: 0x20},
+		},
+		{points: []heretic.Vec3{ua, ub, uc}, texcoords: none, color: green, source: Polygon{Code: 0x28, Quad: 1}},
+		{points: []heretic.Vec3{ub, ud, uc}, texcoords: none, color: green, source: Polygon{Code: 0x28, Quad: 2}},
+	}
+
+	if len(m.Mesh.Triangles) != len(want) {
+		t.Fatalf("got %d triangles, want %d", len(m.Mesh.Triangles), len(want))
+	}
+	for i, w := range want {
+		g := m.Mesh.Triangles[i]
+		got := triangle{g.Points, g.Texcoords, g.BlendMode, g.Color, g.Tile, polygonSource(g)}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("triangle %d = %+v, want %+v", i, got, w)
+		}
+	}
+	for i, idx := range []int{3, 5, 5} {
+		if !palettesEqual(m.Mesh.Triangles[i].Palette, m.Palettes[idx]) {
+			t.Errorf("triangle %d doesn't use palette %d", i, idx)
+		}
+	}
+}
+
+// TestEncodeHandmadeMesh checks that the encoder writes a parsed mesh back
+// byte for byte, quads included.
+func TestEncodeHandmadeMesh(t *testing.T) {
+	data := handmadeMesh()
+	m, err := ParseMesh(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := EncodeMesh(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("encoded mesh differs from the original:\n got % x\nwant % x", got, data)
+	}
+}
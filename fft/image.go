@@ -0,0 +1,177 @@
+// This file contains the ability to use raw BIN images as well as ISO images.
+//
+// An ISO image only has the 2048 bytes of user data of each sector. A raw BIN
+// image has all 2352 bytes: sync, header, subheader, user data and error
+// detection/correction (EDC/ECC). PlayStation discs are Mode 2, so the user
+// data starts after the 16 byte sync/header and the 8 byte subheader.
+//
+// discImage hides the difference. It presents the user data of either kind of
+// image as if it was an ISO, and keeps the EDC/ECC up to date when writing to a
+// BIN image.
+package fft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	rawSectorSize int64 = 2352
+	rawDataOffset int64 = 24 // 12 sync + 4 header + 8 subheader
+)
+
+var rawSync = []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}
+
+// discImage reads and writes the user data of an ISO or raw BIN image.
+type discImage struct {
+	data io.ReaderAt
+	raw  bool
+}
+
+// newDiscImage detects whether the image is raw by looking for the sync
+// pattern at the start of the first sector. An ISO image starts with the
+// system area, which is zero.
+func newDiscImage(data io.ReaderAt) discImage {
+	sync := make([]byte, len(rawSync))
+	if _, err := data.ReadAt(sync, 0); err == nil && bytes.Equal(sync, rawSync) {
+		return discImage{data: data, raw: true}
+	}
+	return discImage{data: data}
+}
+
+// ReadAt reads user data as if the image was an ISO.
+func (d discImage) ReadAt(p []byte, off int64) (int, error) {
+	if !d.raw {
+		return d.data.ReadAt(p, off)
+	}
+
+	n := 0
+	for n < len(p) {
+		sector := (off + int64(n)) / sectorSize
+		within := (off + int64(n)) % sectorSize
+		chunk := p[n:min64(int64(len(p)), int64(n)+sectorSize-within)]
+
+		read, err := d.data.ReadAt(chunk, sector*rawSectorSize+rawDataOffset+within)
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// WriteAt writes user data as if the image was an ISO. For raw images, every
+// sector that is written to gets its EDC/ECC recomputed.
+func (d discImage) WriteAt(p []byte, off int64) (int, error) {
+	w, ok := d.data.(io.WriterAt)
+	if !ok {
+		return 0, fmt.Errorf("image is read only")
+	}
+	if !d.raw {
+		return w.WriteAt(p, off)
+	}
+
+	n := 0
+	for n < len(p) {
+		sector := (off + int64(n)) / sectorSize
+		within := (off + int64(n)) % sectorSize
+		chunk := p[n:min64(int64(len(p)), int64(n)+sectorSize-within)]
+
+		raw := make([]byte, rawSectorSize)
+		if _, err := d.data.ReadAt(raw, sector*rawSectorSize); err != nil {
+			return n, fmt.Errorf("read raw sector %d: %w", sector, err)
+		}
+		if raw[15] != 2 || raw[18]&0x20 != 0 {
+			return n, fmt.Errorf("raw sector %d is not mode 2 form 1", sector)
+		}
+		copy(raw[rawDataOffset+within:], chunk)
+		sectorEDCECC(raw)
+		if _, err := w.WriteAt(raw, sector*rawSectorSize); err != nil {
+			return n, fmt.Errorf("write raw sector %d: %w", sector, err)
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// The EDC is a 32-bit CRC and the ECC is Reed-Solomon product code parity
+// over GF(2^8). The lookup tables and algorithm are the ones used by every
+// CD image tool since ECM.
+var (
+	eccFLUT [256]uint8
+	eccBLUT [256]uint8
+	edcLUT  [256]uint32
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		j := i << 1
+		if i&0x80 != 0 {
+			j ^= 0x11D
+		}
+		eccFLUT[i] = uint8(j)
+		eccBLUT[i^j] = uint8(i)
+
+		edc := uint32(i)
+		for k := 0; k < 8; k++ {
+			if edc&1 != 0 {
+				edc = (edc >> 1) ^ 0xD8018001
+			} else {
+				edc >>= 1
+			}
+		}
+		edcLUT[i] = edc
+	}
+}
+
+func computeEDC(data []byte) uint32 {
+	var edc uint32
+	for _, b := range data {
+		edc = (edc >> 8) ^ edcLUT[(edc^uint32(b))&0xFF]
+	}
+	return edc
+}
+
+// computeECCBlock computes one set (P or Q) of parity bytes.
+func computeECCBlock(src []byte, majorCount, minorCount, majorMult, minorInc int, dest []byte) {
+	size := majorCount * minorCount
+	for major := 0; major < majorCount; major++ {
+		index := (major>>1)*majorMult + (major & 1)
+		var eccA, eccB uint8
+		for minor := 0; minor < minorCount; minor++ {
+			temp := src[index]
+			index += minorInc
+			if index >= size {
+				index -= size
+			}
+			eccA ^= temp
+			eccB ^= temp
+			eccA = eccFLUT[eccA]
+		}
+		eccA = eccBLUT[eccFLUT[eccA]^eccB]
+		dest[major] = eccA
+		dest[major+majorCount] = eccA ^ eccB
+	}
+}
+
+// sectorEDCECC recomputes the EDC and ECC of a raw mode 2 form 1 sector. The
+// header is treated as zero when computing the ECC of mode 2 sectors.
+func sectorEDCECC(raw []byte) {
+	binary.LittleEndian.PutUint32(raw[0x818:], computeEDC(raw[0x10:0x818]))
+
+	var header [4]byte
+	copy(header[:], raw[0xC:0x10])
+	copy(raw[0xC:0x10], []byte{0, 0, 0, 0})
+	computeECCBlock(raw[0xC:], 86, 24, 2, 86, raw[0x81C:])  // P parity
+	computeECCBlock(raw[0xC:], 52, 43, 86, 88, raw[0x8C8:]) // Q parity
+	copy(raw[0xC:0x10], header[:])
+}
@@ -0,0 +1,268 @@
+// This file contains a way to dump the raw structure of a map.
+//
+// When a map renders wrong, the parsed Map doesn't say why. An Inspection is
+// what is actually in the files: the GNS records, the pointers of each mesh
+// file header, the polygon counts, the palettes and the lights. A mesh that
+// fails to parse is still inspected as far as possible, with the error.
+package fft
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io"
+
+	"github.com/adamrt/heretic"
+)
+
+// Inspection is the raw structure of a map. It can be written as text with
+// WriteText or marshalled as JSON.
+type Inspection struct {
+	Map     int                `json:"map"`
+	Name    string             `json:"name"`
+	Records []RecordInspection `json:"records"`
+	Meshes  []MeshInspection   `json:"meshes"`
+}
+
+// RecordInspection is a single GNS record. The type, time and weather are
+// given both as names and as the numbers in the record, since unknown values
+// don't have a name.
+type RecordInspection struct {
+	Index     int    `json:"index"`
+	Type      string `json:"type"`
+	TypeID    int    `json:"type_id"`
+	Sector    int64  `json:"sector"`
+	Length    int64  `json:"length"`
+	Time      string `json:"time"`
+	TimeID    int    `json:"time_id"`
+	Weather   string `json:"weather"`
+	WeatherID int    `json:"weather_id"`
+}
+
+// MeshInspection is the structure of the file a mesh record points to.
+type MeshInspection struct {
+	// Record is the index of the record in Records.
+	Record int `json:"record"`
+
+	Pointers     []PointerInspection `json:"pointers"`
+	Polygons     *PolygonCounts      `json:"polygons,omitempty"`
+	Palettes     [][]ColorInspection `json:"palettes,omitempty"`
+	GrayPalettes [][]ColorInspection `json:"gray_palettes,omitempty"`
+	Lights       *LightsInspection   `json:"lights,omitempty"`
+
+	// Error is why the mesh couldn't be fully parsed.
+	Error string `json:"error,omitempty"`
+}
+
+// PointerInspection is a non-zero mesh file header pointer.
+type PointerInspection struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+}
+
+// ColorInspection is a color as it is stored, with the STP bit.
+type ColorInspection struct {
+	R   uint8 `json:"r"`
+	G   uint8 `json:"g"`
+	B   uint8 `json:"b"`
+	A   uint8 `json:"a"`
+	STP bool  `json:"stp,omitempty"`
+}
+
+// LightsInspection is the lights and background section.
+type LightsInspection struct {
+	Directional      []DirectionalLightInspection `json:"directional"`
+	Ambient          ColorInspection              `json:"ambient"`
+	BackgroundTop    ColorInspection              `json:"background_top"`
+	BackgroundBottom ColorInspection              `json:"background_bottom"`
+}
+
+// DirectionalLightInspection is a light in FFT coordinates.
+type DirectionalLightInspection struct {
+	Color    ColorInspection `json:"color"`
+	Position heretic.Vec3    `json:"position"`
+}
+
+// Inspect reads the records of the map and the structure of every mesh they
+// point to. An error is only returned if the GNS file can't be read.
+func (r MeshReader) Inspect(mapNum int) (Inspection, error) {
+	records, err := r.readGNSRecords(mapNum)
+	if err != nil {
+		return Inspection{}, err
+	}
+
+	ins := Inspection{Map: mapNum, Name: MapName(mapNum), Records: []RecordInspection{}, Meshes: []MeshInspection{}}
+	for i, record := range records {
+		ins.Records = append(ins.Records, RecordInspection{
+			Index:     i,
+			Type:      record.Type().String(),
+			TypeID:    int(record.Type()),
+			Sector:    record.Sector(),
+			Length:    record.Len(),
+			Time:      record.Time().String(),
+			TimeID:    int(record.Time()),
+			Weather:   record.Weather().String(),
+			WeatherID: int(record.Weather()),
+		})
+
+		switch record.Type() {
+		case RecordTypeMeshPrimary, RecordTypeMeshAlt, RecordTypeMeshOverride:
+			mesh := MeshInspection{Record: i}
+			data, err := r.readResource(mapNum, record)
+			if err != nil {
+				mesh.Error = err.Error()
+			} else {
+				mesh = inspectMesh(data)
+				mesh.Record = i
+			}
+			ins.Meshes = append(ins.Meshes, mesh)
+		}
+	}
+	return ins, nil
+}
+
+// inspectMesh reads as much of the mesh file as it can. The pointers and
+// counts are read even when the sections can't be.
+func inspectMesh(data []byte) MeshInspection {
+	mesh := MeshInspection{Pointers: []PointerInspection{}}
+	if len(data) < meshFileHeaderLen {
+		mesh.Error = fmt.Sprintf("mesh is %d bytes, shorter than the header", len(data))
+		return mesh
+	}
+
+	fileHeader := meshFileHeader(data[:meshFileHeaderLen])
+	for _, p := range meshFilePointers {
+		if ptr := fileHeader.ptr(p.location); ptr != 0 {
+			mesh.Pointers = append(mesh.Pointers, PointerInspection{Name: p.name, Offset: ptr})
+		}
+	}
+
+	if ptr := fileHeader.PrimaryMesh(); ptr != 0 && ptr+meshHeaderLen <= int64(len(data)) {
+		dr := newDataReader(bytes.NewReader(data), ptr)
+		header := meshHeader(dr.readBytes(meshHeaderLen))
+		mesh.Polygons = &PolygonCounts{
+			TexturedTriangles:   header.N(),
+			TexturedQuads:       header.P(),
+			UntexturedTriangles: header.Q(),
+			UntexturedQuads:     header.R(),
+		}
+	}
+
+	sections, err := parseMeshSections(data)
+	if err != nil {
+		mesh.Error = err.Error()
+		return mesh
+	}
+	mesh.Palettes = inspectPalettes(sections.palettes)
+	mesh.GrayPalettes = inspectPalettes(sections.grayPalettes)
+	if l := sections.lights; l != nil {
+		lights := &LightsInspection{
+			Ambient:          inspectColor(l.ambient.Color),
+			BackgroundTop:    inspectColor(l.background.Top),
+			BackgroundBottom: inspectColor(l.background.Bottom),
+		}
+		for _, d := range l.directional {
+			lights.Directional = append(lights.Directional, DirectionalLightInspection{Color: inspectColor(d.Color), Position: d.Position})
+		}
+		mesh.Lights = lights
+	}
+	return mesh
+}
+
+func inspectPalettes(palettes []heretic.Palette) [][]ColorInspection {
+	var inspected [][]ColorInspection
+	for _, palette := range palettes {
+		colors := make([]ColorInspection, len(palette))
+		for i, c := range palette {
+			colors[i] = inspectColor(c.NRGBA)
+			colors[i].STP = c.STP
+		}
+		inspected = append(inspected, colors)
+	}
+	return inspected
+}
+
+func inspectColor(c color.NRGBA) ColorInspection {
+	return ColorInspection{R: c.R, G: c.G, B: c.B, A: c.A}
+}
+
+// String returns the color as #rrggbb. Transparent colors are "-------" and
+// colors with the STP bit have a "*" after them.
+func (c ColorInspection) String() string {
+	if c.A == 0 {
+		return "-------"
+	}
+	s := fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	if c.STP {
+		s += "*"
+	}
+	return s
+}
+
+// WriteText writes the inspection in a human readable form.
+func (ins Inspection) WriteText(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("MAP%03d %s\n\n", ins.Map, ins.Name)
+
+	ew.printf("Records:\n")
+	ew.printf("  %3s  %-14s %6s  %6s  %8s  %-5s  %s\n", "#", "type", "id", "sector", "length", "time", "weather")
+	for _, r := range ins.Records {
+		ew.printf("  %3d  %-14s %#06x  %6d  %8d  %-5s  %s\n", r.Index, r.Type, r.TypeID, r.Sector, r.Length, r.Time, r.Weather)
+	}
+
+	for _, m := range ins.Meshes {
+		r := ins.Records[m.Record]
+		ew.printf("\nMesh record %d (%s, %s/%s):\n", m.Record, r.Type, r.Time, r.Weather)
+
+		ew.printf("  Pointers:\n")
+		for _, p := range m.Pointers {
+			ew.printf("    %-24s %#08x (%d)\n", p.Name, p.Offset, p.Offset)
+		}
+		if p := m.Polygons; p != nil {
+			ew.printf("  Polygons: N=%d P=%d Q=%d R=%d (%d triangles)\n",
+				p.TexturedTriangles, p.TexturedQuads, p.UntexturedTriangles, p.UntexturedQuads, p.Triangles())
+		}
+		ew.printPalettes("Palettes", m.Palettes)
+		ew.printPalettes("Gray palettes", m.GrayPalettes)
+		if l := m.Lights; l != nil {
+			ew.printf("  Lights:\n")
+			for i, d := range l.Directional {
+				ew.printf("    directional %d: %s at (%g, %g, %g)\n", i, d.Color, d.Position.X, d.Position.Y, d.Position.Z)
+			}
+			ew.printf("    ambient: %s\n", l.Ambient)
+			ew.printf("    background: %s to %s\n", l.BackgroundTop, l.BackgroundBottom)
+		}
+		if m.Error != "" {
+			ew.printf("  Error: %s\n", m.Error)
+		}
+	}
+	return ew.err
+}
+
+func (ew *errWriter) printPalettes(title string, palettes [][]ColorInspection) {
+	if len(palettes) == 0 {
+		return
+	}
+	ew.printf("  %s:\n", title)
+	for i, palette := range palettes {
+		ew.printf("    %2d:", i)
+		for _, c := range palette {
+			ew.printf(" %-8s", c)
+		}
+		ew.printf("\n")
+	}
+}
+
+// errWriter keeps the first write error so a sequence of writes only needs
+// one check, like dataReader.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
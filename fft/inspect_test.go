@@ -0,0 +1,90 @@
+package fft
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	ins, err := testReader(t, testImages(t)["iso"]).Inspect(testMapNum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ins.Records) != 5 || len(ins.Meshes) != 3 {
+		t.Fatalf("%d records and %d meshes, want 5 and 3", len(ins.Records), len(ins.Meshes))
+	}
+	if r := ins.Records[2]; r.Type != "mesh primary" || r.Time != "night" || r.TimeID != int(TimeNight) {
+		t.Errorf("record 2 = %+v", r)
+	}
+
+	primary := ins.Meshes[0]
+	if primary.Error != "" {
+		t.Fatal(primary.Error)
+	}
+	want := []string{"primary mesh", "texture palettes color", "lights and background", "terrain", "texture animation", "texture palettes gray", "visibility angles"}
+	if len(primary.Pointers) != len(want) {
+		t.Fatalf("pointers = %+v", primary.Pointers)
+	}
+	for i, name := range want {
+		if primary.Pointers[i].Name != name {
+			t.Errorf("pointer %d = %q, want %q", i, primary.Pointers[i].Name, name)
+		}
+	}
+	if p := primary.Polygons; p == nil || p.TexturedTriangles != 3 || p.TexturedQuads != 1 || p.UntexturedTriangles != 1 || p.UntexturedQuads != 1 {
+		t.Errorf("polygons = %+v", p)
+	}
+	if len(primary.Palettes) != 16 || !primary.Palettes[1][1].STP {
+		t.Error("wrong palettes")
+	}
+	if len(primary.GrayPalettes) != 16 {
+		t.Error("wrong gray palettes")
+	}
+	if primary.Lights == nil || primary.Lights.BackgroundBottom.R != 200 {
+		t.Errorf("lights = %+v", primary.Lights)
+	}
+
+	// The override has no mesh, so no polygons.
+	if override := ins.Meshes[2]; override.Polygons != nil || len(override.Pointers) != 1 {
+		t.Errorf("override = %+v", override)
+	}
+
+	var text bytes.Buffer
+	if err := ins.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"MAP001 At Main Gate of Igros Castle", "mesh override", "N=3 P=1 Q=1 R=1", "#c89664"} {
+		if !strings.Contains(text.String(), s) {
+			t.Errorf("text is missing %q:\n%s", s, text.String())
+		}
+	}
+
+	b, err := json.Marshal(ins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"time":"night","time_id":1`, `"weather_id":`} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("JSON is missing %s", s)
+		}
+	}
+}
+
+func TestInspectBrokenMesh(t *testing.T) {
+	valid, err := EncodeMesh(testMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte{}, valid...)
+	meshFileHeader(data).setPtr(ptrTerrain, int64(len(data)))
+
+	mesh := inspectMesh(data)
+	if mesh.Error == "" {
+		t.Error("expected an error")
+	}
+	if mesh.Polygons == nil || len(mesh.Pointers) != 7 {
+		t.Error("pointers and counts should be read even if the mesh is broken")
+	}
+}
@@ -1,5 +1,4 @@
-// This file contains a way to read binary data from the FFT ISO.
-// It should be expanded to also read the FFT bin file.
+// This file contains a way to read binary data from the FFT ISO or BIN file.
 //
 // It contains the low level methods for different sized ints/uints as well has
 // some simple geometry parsing. The higher level iso parsing happens in map.go.
@@ -8,7 +7,9 @@ package fft
 
 import (
 	"encoding/binary"
+	"fmt"
 	"image/color"
+	"io"
 	"log"
 	"math"
 	"os"
@@ -18,76 +19,115 @@ import (
 
 const sectorSize int64 = 2048
 
+// NewISOReader opens the ISO file and identifies which version of the game it
+// is. The file is closed by ISOReader.Close().
 func NewISOReader(filename string) ISOReader {
 	f, err := os.Open(filename)
 	if err != nil {
 		log.Fatalf("open iso: %v", err)
 	}
-	return ISOReader{f}
+	r, err := NewISOReaderAt(f)
+	if err != nil {
+		f.Close()
+		log.Fatalf("open iso %s: %v", filename, err)
+	}
+	r.closer = f
+	return r
 }
 
+// NewISOReaderAt returns an ISOReader backed by any io.ReaderAt, such as a
+// bytes.Reader holding an image in memory. The image can be an ISO or a raw
+// BIN. An error is returned if the image isn't a known version of the game.
+func NewISOReaderAt(data io.ReaderAt) (ISOReader, error) {
+	return newISOReader(newDiscImage(data))
+}
+
+func newISOReader(image discImage) (ISOReader, error) {
+	info, err := Identify(image)
+	if err != nil {
+		return ISOReader{}, err
+	}
+	return ISOReader{data: image, info: info}, nil
+}
+
+// ISOReader reads from an ISO image. It doesn't hold a read position. Every
+// read goes through a section of the image with its own offset, so an
+// ISOReader can be used from multiple goroutines at once.
 type ISOReader struct {
-	file *os.File
+	data   io.ReaderAt
+	closer io.Closer
+	info   DiscInfo
 }
 
-func (r ISOReader) Close() {
-	r.file.Close()
+// Info returns what was found when identifying the disc.
+func (r ISOReader) Info() DiscInfo {
+	return r.info
 }
 
-// seekSector will seek to the specified sector of the iso file.
-func (r ISOReader) seekSector(sector int64) {
-	to := sector * sectorSize
-	_, err := r.file.Seek(to, 0)
-	if err != nil {
-		log.Fatalf("seek to sector: %v", err)
+func (r ISOReader) Close() {
+	if r.closer != nil {
+		r.closer.Close()
 	}
 }
 
-// seekPointer will seek to the specified sector, plus a little more, of the iso
-// file. This is useful when using MeshFileHeader intra-file pointers.
-func (r ISOReader) seekPointer(sector int64, ptr int64) {
-	to := sector*sectorSize + ptr
-	_, err := r.file.Seek(to, 0)
-	if err != nil {
-		log.Fatalf("seek to pointer: %v", err)
-	}
+// section returns the part of the image that starts at the sector and is n
+// bytes long.
+func (r ISOReader) section(sector int64, n int64) *io.SectionReader {
+	return io.NewSectionReader(r.data, sector*sectorSize, n)
 }
 
-func (r ISOReader) readUint8() uint8 {
-	size := 1
-	data := make([]byte, size)
-	n, err := r.file.Read(data)
-	if err != nil || n != size {
-		log.Fatal(err)
-	}
-	return data[0]
+// dataReader reads sequential little-endian data from a file. Each read
+// advances its own offset and leaves the underlying io.ReaderAt untouched.
+//
+// The first read error is kept in err and every read after it returns zero
+// values. Callers check err once after reading a section instead of after
+// every value.
+type dataReader struct {
+	data io.ReaderAt
+	off  int64
+	err  error
 }
 
-func (r ISOReader) readUint16() uint16 {
-	size := 2
-	data := make([]byte, size)
-	n, err := r.file.Read(data)
-	if err != nil || n != size {
-		log.Fatal(err)
-	}
-	return binary.LittleEndian.Uint16(data)
+// newDataReader returns a dataReader positioned at the offset. This is useful
+// when using MeshFileHeader intra-file pointers.
+func newDataReader(data io.ReaderAt, off int64) *dataReader {
+	return &dataReader{data: data, off: off}
 }
 
-func (r ISOReader) readUint32() uint32 {
-	size := 4
-	data := make([]byte, size)
-	n, err := r.file.Read(data)
-	if err != nil || n != size {
-		log.Fatal(err)
+// readBytes reads the next n bytes.
+func (r *dataReader) readBytes(n int) []byte {
+	data := make([]byte, n)
+	if r.err != nil {
+		return data
 	}
-	return binary.LittleEndian.Uint32(data)
+	// ReadAt may return io.EOF along with a full read at the end of the
+	// data, so only the count matters.
+	read, err := r.data.ReadAt(data, r.off)
+	if read != n {
+		r.err = fmt.Errorf("read %d bytes at offset %d: %w", n, r.off, err)
+		return data
+	}
+	r.off += int64(n)
+	return data
 }
 
-func (r ISOReader) readInt8() int8   { return int8(r.readUint8()) }
-func (r ISOReader) readInt16() int16 { return int16(r.readUint16()) }
-func (r ISOReader) readInt32() int32 { return int32(r.readUint32()) }
+func (r *dataReader) readUint8() uint8 {
+	return r.readBytes(1)[0]
+}
 
-func (r ISOReader) readRGB8() color.NRGBA {
+func (r *dataReader) readUint16() uint16 {
+	return binary.LittleEndian.Uint16(r.readBytes(2))
+}
+
+func (r *dataReader) readUint32() uint32 {
+	return binary.LittleEndian.Uint32(r.readBytes(4))
+}
+
+func (r *dataReader) readInt8() int8   { return int8(r.readUint8()) }
+func (r *dataReader) readInt16() int16 { return int16(r.readUint16()) }
+func (r *dataReader) readInt32() int32 { return int32(r.readUint32()) }
+
+func (r *dataReader) readRGB8() color.NRGBA {
 	return color.NRGBA{
 		R: r.readUint8(),
 		G: r.readUint8(),
@@ -96,7 +136,10 @@ func (r ISOReader) readRGB8() color.NRGBA {
 	}
 }
 
-func (mr ISOReader) readRGB15() color.NRGBA {
+// readRGB15 reads a PlayStation 15-bit color. Bit 15 is the semi-transparency
+// (STP) bit. A value of 0x0000 is fully transparent, but 0x8000 (black with
+// STP) is an opaque black.
+func (mr *dataReader) readRGB15() heretic.PaletteColor {
 	val := mr.readUint16()
 	var a uint8
 	if val == 0 {
@@ -108,17 +151,18 @@ func (mr ISOReader) readRGB15() color.NRGBA {
 	b := uint8((val & 0b01111100_00000000) >> 7)
 	g := uint8((val & 0b00000011_11100000) >> 2)
 	r := uint8((val & 0b00000000_00011111) << 3)
-	return color.NRGBA{R: r, G: g, B: b, A: a}
+	stp := val&0b10000000_00000000 != 0
+	return heretic.PaletteColor{NRGBA: color.NRGBA{R: r, G: g, B: b, A: a}, STP: stp}
 }
 
-func (r ISOReader) readVertex() heretic.Vec3 {
+func (r *dataReader) readVertex() heretic.Vec3 {
 	x := float64(r.readInt16())
 	y := float64(r.readInt16())
 	z := float64(r.readInt16())
 	return heretic.Vec3{X: x, Y: -y, Z: z}
 }
 
-func (r ISOReader) readTriangle() heretic.Triangle {
+func (r *dataReader) readTriangle() heretic.Triangle {
 	a := r.readVertex()
 	b := r.readVertex()
 	c := r.readVertex()
@@ -130,7 +174,7 @@ func (r ISOReader) readTriangle() heretic.Triangle {
 	return heretic.Triangle{Points: []heretic.Vec3{a, b, c}, Texcoords: empty}
 }
 
-func (r ISOReader) readQuad() quad {
+func (r *dataReader) readQuad() quad {
 	a := r.readVertex()
 	b := r.readVertex()
 	c := r.readVertex()
@@ -138,25 +182,25 @@ func (r ISOReader) readQuad() quad {
 	return quad{a, b, c, d}
 }
 
-func (r ISOReader) readF1x3x12() float64 {
+func (r *dataReader) readF1x3x12() float64 {
 	return float64(r.readInt16()) / 4096.0
 }
 
-func (r ISOReader) readNormal() heretic.Vec3 {
+func (r *dataReader) readNormal() heretic.Vec3 {
 	x := r.readF1x3x12()
 	y := r.readF1x3x12()
 	z := r.readF1x3x12()
 	return heretic.Vec3{X: x, Y: -y, Z: z}
 }
 
-func (r ISOReader) readTriNormal() []heretic.Vec3 {
+func (r *dataReader) readTriNormal() []heretic.Vec3 {
 	a := r.readNormal()
 	b := r.readNormal()
 	c := r.readNormal()
 	return []heretic.Vec3{a, b, c}
 }
 
-func (r ISOReader) readQuadNormal() []heretic.Vec3 {
+func (r *dataReader) readQuadNormal() []heretic.Vec3 {
 	a := r.readNormal()
 	b := r.readNormal()
 	c := r.readNormal()
@@ -164,52 +208,93 @@ func (r ISOReader) readQuadNormal() []heretic.Vec3 {
 	return []heretic.Vec3{a, b, c, d}
 }
 
-func (r ISOReader) readUV() heretic.Tex {
+func (r *dataReader) readUV() heretic.Tex {
 	x := float64(r.readUint8())
 	y := float64(r.readUint8())
 	return heretic.Tex{U: x, V: y}
 }
 
-func (r ISOReader) readTriUV() textureData {
+// The texture data of a polygon follows the layout of a PlayStation GPU
+// polygon command. The palette is the low 4 bits of the CLUT attribute and
+// the page is the low 2 bits of the texpage attribute.
+func (r *dataReader) readTriUV() textureData {
 	a := r.readUV()
-	palette := int(r.readUint8() & 0b1111)
-	r.readUint8() // padding
+	clut := r.readUint16()
 	b := r.readUV()
-	page := int(r.readUint8() & 0b11) // only 2 bits
-	r.readUint8()                     // padding
+	texpage := r.readUint16()
 	c := r.readUV()
-
-	a = processTexCoords(a, page)
-	b = processTexCoords(b, page)
-	c = processTexCoords(c, page)
-
-	return textureData{texCoords: []heretic.Tex{a, b, c}, palette: palette}
+	return newTextureData([]heretic.Tex{a, b, c}, clut, texpage)
 }
 
-func (r ISOReader) readQuadUV() textureData {
+func (r *dataReader) readQuadUV() textureData {
 	a := r.readUV()
-	palette := int(r.readUint8() & 0b1111)
-	r.readUint8() // padding
+	clut := r.readUint16()
 	b := r.readUV()
-	page := int(r.readUint8() & 0b11) // only 2 bits
-	r.readUint8()                     // padding
+	texpage := r.readUint16()
 	c := r.readUV()
 	d := r.readUV()
+	return newTextureData([]heretic.Tex{a, b, c, d}, clut, texpage)
+}
 
-	a = processTexCoords(a, page)
-	b = processTexCoords(b, page)
-	c = processTexCoords(c, page)
-	d = processTexCoords(d, page)
+func newTextureData(texCoords []heretic.Tex, clut, texpage uint16) textureData {
+	page := int(texpage & 0b11) // only 2 bits
+	for i, uv := range texCoords {
+		texCoords[i] = processTexCoords(uv, page)
+	}
+	return textureData{
+		texCoords: texCoords,
+		palette:   int(clut & 0b1111),
+		blendMode: texpageBlendMode(texpage),
+		clut:      clut,
+		texpage:   texpage,
+	}
+}
+
+// texpageSemiTransparent is the bit of the texpage attribute that makes a
+// polygon semi-transparent. The GPU doesn't use the high bits of the
+// attribute for polygons, FFT keeps the polygon's flag in bit 9.
+const texpageSemiTransparent = 1 << 9
+
+// texpageBlendMode returns how the polygon blends. Polygons without the
+// semi-transparency flag are opaque, even if their palette has STP colors.
+// Semi-transparent polygons blend with the mode in bits 5-6 and, like on the
+// PlayStation, only their texels with the STP bit set are blended.
+func texpageBlendMode(texpage uint16) heretic.BlendMode {
+	if texpage&texpageSemiTransparent == 0 {
+		return heretic.BlendModeOpaque
+	}
+	return heretic.BlendModeAverage + heretic.BlendMode((texpage>>5)&0b11)
+}
+
+// readUntexturedData reads the 4 bytes of data that each untextured polygon
+// has after the textured polygon data. The first three look like a color and
+// are drawn as one, but that is a guess. What the last byte means isn't known,
+// so it is only kept for the encoder.
+func (r *dataReader) readUntexturedData() (color.NRGBA, uint8) {
+	c := r.readRGB8()
+	code := r.readUint8()
+	return c, code
+}
 
-	return textureData{texCoords: []heretic.Tex{a, b, c, d}, palette: palette}
+// readTileLocation reads the terrain tile a textured polygon sits on. The
+// first byte is the Z coordinate shifted left by one with the level in the
+// lowest bit. The second byte is the X coordinate. It returns nil for
+// noTileLocation.
+func (r *dataReader) readTileLocation() *heretic.TileLocation {
+	zl := r.readUint8()
+	x := r.readUint8()
+	if uint16(zl)|uint16(x)<<8 == noTileLocation {
+		return nil
+	}
+	return &heretic.TileLocation{X: int(x), Z: int(zl >> 1), Level: int(zl & 0b1)}
 }
 
-func (r ISOReader) readLightColor() uint8 {
+func (r *dataReader) readLightColor() uint8 {
 	val := r.readF1x3x12()
 	return uint8(255 * math.Min(math.Max(0.0, val), 1.0))
 }
 
-func (r ISOReader) readDirectionalLights() []heretic.DirectionalLight {
+func (r *dataReader) readDirectionalLights() []heretic.DirectionalLight {
 	l1r, l2r, l3r := r.readLightColor(), r.readLightColor(), r.readLightColor()
 	l1g, l2g, l3g := r.readLightColor(), r.readLightColor(), r.readLightColor()
 	l1b, l2b, l3b := r.readLightColor(), r.readLightColor(), r.readLightColor()
@@ -227,13 +312,13 @@ func (r ISOReader) readDirectionalLights() []heretic.DirectionalLight {
 	}
 }
 
-func (r ISOReader) readAmbientLight() heretic.AmbientLight {
+func (r *dataReader) readAmbientLight() heretic.AmbientLight {
 	color := r.readRGB8()
 	return heretic.AmbientLight{Color: color}
 
 }
 
-func (r ISOReader) readBackground() heretic.Background {
+func (r *dataReader) readBackground() heretic.Background {
 	top := r.readRGB8()
 	bottom := r.readRGB8()
 	return heretic.Background{Top: top, Bottom: bottom}
@@ -0,0 +1,169 @@
+// This file contains just enough ISO9660 parsing to find files on the disc.
+//
+// The primary volume descriptor is always at sector 16. It contains the volume
+// ID and the directory record of the root directory. Directory records point
+// to the sector and size of each file and subdirectory.
+package fft
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	pvdSector       int64 = 16
+	pvdVolumeID           = 40  // 32 bytes, padded with spaces
+	pvdRootRecord         = 156 // 34 byte directory record
+	dirRecordMinLen       = 33
+
+	// maxDiscSectors is the most a CD holds, 80 minutes at 75 sectors a
+	// second.
+	maxDiscSectors int64 = 80 * 60 * 75
+)
+
+// isoFile is a file or directory found in a directory record.
+type isoFile struct {
+	name   string // Without the ";1" version suffix
+	sector int64
+	size   int64
+	isDir  bool
+
+	// recordOffset is the byte offset of the directory record within the
+	// image. It is needed to update the size when patching the disc.
+	recordOffset int64
+}
+
+// readPVD reads the volume ID and root directory from the primary volume
+// descriptor.
+func readPVD(data io.ReaderAt) (string, isoFile, error) {
+	dr := newDataReader(data, pvdSector*sectorSize)
+	pvd := dr.readBytes(int(sectorSize))
+	if dr.err != nil {
+		return "", isoFile{}, fmt.Errorf("read primary volume descriptor: %w", dr.err)
+	}
+	if pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		return "", isoFile{}, fmt.Errorf("no primary volume descriptor")
+	}
+	volumeID := strings.TrimRight(string(pvd[pvdVolumeID:pvdVolumeID+32]), " ")
+	root := parseDirRecord(pvd[pvdRootRecord:], pvdSector*sectorSize+pvdRootRecord)
+	return volumeID, root, nil
+}
+
+// parseDirRecord parses a single directory record. offset is where the record
+// is in the image.
+func parseDirRecord(record []byte, offset int64) isoFile {
+	nameLen := int(record[32])
+	name := string(record[33 : 33+nameLen])
+	if i := strings.IndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	return isoFile{
+		name:         name,
+		sector:       int64(binary.LittleEndian.Uint32(record[2:6])),
+		size:         int64(binary.LittleEndian.Uint32(record[10:14])),
+		isDir:        record[25]&0b10 != 0,
+		recordOffset: offset,
+	}
+}
+
+// readDirectory returns the entries of a directory, without the "." and ".."
+// entries.
+func readDirectory(data io.ReaderAt, dir isoFile) ([]isoFile, error) {
+	if err := checkExtent(data, dir); err != nil {
+		return nil, err
+	}
+	dr := newDataReader(data, dir.sector*sectorSize)
+	raw := dr.readBytes(int(dir.size))
+	if dr.err != nil {
+		return nil, fmt.Errorf("read directory %q: %w", dir.name, dr.err)
+	}
+
+	files := []isoFile{}
+	for pos := 0; pos < len(raw); {
+		recordLen := int(raw[pos])
+
+		// Records never cross a sector boundary. The rest of the
+		// sector is zero filled.
+		if recordLen == 0 {
+			pos = (pos/int(sectorSize) + 1) * int(sectorSize)
+			continue
+		}
+		if recordLen < dirRecordMinLen || pos+recordLen > len(raw) || dirRecordMinLen+int(raw[pos+32]) > recordLen {
+			return nil, fmt.Errorf("bad directory record in %q at %d", dir.name, pos)
+		}
+
+		file := parseDirRecord(raw[pos:pos+recordLen], dir.sector*sectorSize+int64(pos))
+		// The "." and ".." entries have the names 0x00 and 0x01.
+		if file.name != "\x00" && file.name != "\x01" {
+			files = append(files, file)
+		}
+		pos += recordLen
+	}
+	return files, nil
+}
+
+// findISOFile finds a file by its path, such as "MAP/MAP000.GNS". Names are
+// matched case insensitively.
+func findISOFile(data io.ReaderAt, path string) (isoFile, error) {
+	_, current, err := readPVD(data)
+	if err != nil {
+		return isoFile{}, err
+	}
+
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if !current.isDir {
+			return isoFile{}, fmt.Errorf("%q: %q is not a directory", path, current.name)
+		}
+		files, err := readDirectory(data, current)
+		if err != nil {
+			return isoFile{}, err
+		}
+		found := false
+		for _, file := range files {
+			if strings.EqualFold(file.name, part) {
+				current, found = file, true
+				break
+			}
+		}
+		if !found {
+			return isoFile{}, fmt.Errorf("%q: not found", path)
+		}
+	}
+	return current, nil
+}
+
+// readISOFile returns the contents of a file on the disc.
+func readISOFile(data io.ReaderAt, path string) ([]byte, error) {
+	file, err := findISOFile(data, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkExtent(data, file); err != nil {
+		return nil, err
+	}
+	dr := newDataReader(data, file.sector*sectorSize)
+	contents := dr.readBytes(int(file.size))
+	if dr.err != nil {
+		return nil, fmt.Errorf("read %q: %w", path, dr.err)
+	}
+	return contents, nil
+}
+
+// checkExtent makes sure a file is on the disc before it is read. The sector
+// and size come from the directory records, so a broken image could otherwise
+// make the reader allocate up to 4GB.
+func checkExtent(data io.ReaderAt, file isoFile) error {
+	if file.sector+(file.size+sectorSize-1)/sectorSize > maxDiscSectors {
+		return fmt.Errorf("%q at sector %d with %d bytes doesn't fit on a disc", file.name, file.sector, file.size)
+	}
+	if file.size == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	if n, err := data.ReadAt(last, file.sector*sectorSize+file.size-1); n != 1 {
+		return fmt.Errorf("%q at sector %d with %d bytes is past the end of the image: %w", file.name, file.sector, file.size, err)
+	}
+	return nil
+}
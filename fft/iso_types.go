@@ -29,6 +29,49 @@ const (
 	ptrVisibilityAngles     = 0xb0
 )
 
+// meshFilePointers are the names of the pointers, in header order.
+var meshFilePointers = []struct {
+	name     string
+	location int32
+}{
+	{"primary mesh", ptrPrimaryMesh},
+	{"texture palettes color", ptrTexturePalettesColor},
+	{"unknown", ptrUnknown},
+	{"lights and background", ptrLightsAndBackground},
+	{"terrain", ptrTerrain},
+	{"texture animation", ptrTextureAnimInst},
+	{"palette animation", ptrPaletteAnimInst},
+	{"texture palettes gray", ptrTexturePalettesGray},
+	{"mesh animation", ptrMeshAnimInst},
+	{"animated mesh 1", ptrAnimatedMesh1},
+	{"animated mesh 2", ptrAnimatedMesh2},
+	{"animated mesh 3", ptrAnimatedMesh3},
+	{"animated mesh 4", ptrAnimatedMesh4},
+	{"animated mesh 5", ptrAnimatedMesh5},
+	{"animated mesh 6", ptrAnimatedMesh6},
+	{"animated mesh 7", ptrAnimatedMesh7},
+	{"animated mesh 8", ptrAnimatedMesh8},
+	{"visibility angles", ptrVisibilityAngles},
+}
+
+// unparsedPointers are the sections of a mesh file that aren't read into a
+// Map. They are kept as they are so encoding a map doesn't lose them.
+var unparsedPointers = []int32{
+	ptrUnknown,
+	ptrTextureAnimInst,
+	ptrPaletteAnimInst,
+	ptrMeshAnimInst,
+	ptrAnimatedMesh1,
+	ptrAnimatedMesh2,
+	ptrAnimatedMesh3,
+	ptrAnimatedMesh4,
+	ptrAnimatedMesh5,
+	ptrAnimatedMesh6,
+	ptrAnimatedMesh7,
+	ptrAnimatedMesh8,
+	ptrVisibilityAngles,
+}
+
 // meshFileHeader contains 32-bit unsigned little-endian pointers to an area of
 // the mesh data. Zero is returned if there is no pointer.
 type meshFileHeader []byte
@@ -43,6 +86,24 @@ func (h meshFileHeader) ptr(location int32) int64 {
 	return int64(binary.LittleEndian.Uint32(h[location : location+ptrLen]))
 }
 
+// setPtr sets an intra-file pointer. It is used when encoding.
+func (h meshFileHeader) setPtr(location int32, v int64) {
+	binary.LittleEndian.PutUint32(h[location:location+4], uint32(v))
+}
+
+// sectionEnd returns where the section at the pointer ends. Sections don't
+// have a length, so it is the next section, or the end of the data if it is
+// the last.
+func (h meshFileHeader) sectionEnd(ptr int64, dataLen int64) int64 {
+	end := dataLen
+	for _, p := range meshFilePointers {
+		if next := h.ptr(p.location); next > ptr && next < end {
+			end = next
+		}
+	}
+	return end
+}
+
 func (h meshFileHeader) PrimaryMesh() int64          { return h.ptr(ptrPrimaryMesh) }
 func (h meshFileHeader) TexturePalettesColor() int64 { return h.ptr(ptrTexturePalettesColor) }
 func (h meshFileHeader) Unknown() int64              { return h.ptr(ptrUnknown) }
@@ -71,6 +132,16 @@ type meshHeader []byte
 // meshHeaderLen is the length in bytes.
 const meshHeaderLen = 8
 
+// newMeshHeader returns a header with the counts of each polygon type.
+func newMeshHeader(n, p, q, r int) meshHeader {
+	h := make(meshHeader, meshHeaderLen)
+	binary.LittleEndian.PutUint16(h[0:2], uint16(n))
+	binary.LittleEndian.PutUint16(h[2:4], uint16(p))
+	binary.LittleEndian.PutUint16(h[4:6], uint16(q))
+	binary.LittleEndian.PutUint16(h[6:8], uint16(r))
+	return h
+}
+
 func (h meshHeader) N() int {
 	return int(binary.LittleEndian.Uint16(h[0:2]))
 }
@@ -87,12 +158,66 @@ func (h meshHeader) R() int {
 	return int(binary.LittleEndian.Uint16(h[6:8]))
 }
 
-// totalTexTris returns the count of all textured triangles after quads have
-// been split.
+// Lengths in bytes of the data stored for each polygon.
+const (
+	triLen            = 3 * 6
+	quadLen           = 4 * 6
+	triNormalLen      = 3 * 6
+	quadNormalLen     = 4 * 6
+	triUVLen          = 10
+	quadUVLen         = 12
+	untexturedDataLen = 4
+	tileLocationLen   = 2
+)
+
+// noTileLocation is the tile location of a textured polygon that doesn't sit
+// on a tile. It is X 255, Z 127 on the upper level, which is outside of any
+// terrain since maps have at most 256 tiles per level.
+const noTileLocation = 0xFFFF
+
+// dataLen returns the length in bytes of the polygon data that follows the
+// header. It is used to check the counts against the data before reading.
+func (h meshHeader) dataLen() int64 {
+	n, p, q, r := int64(h.N()), int64(h.P()), int64(h.Q()), int64(h.R())
+	return n*(triLen+triNormalLen+triUVLen+tileLocationLen) +
+		p*(quadLen+quadNormalLen+quadUVLen+tileLocationLen) +
+		q*(triLen+untexturedDataLen) +
+		r*(quadLen+untexturedDataLen)
+}
+
+// TT returns the count of all textured triangles after quads have been split.
 func (h meshHeader) TT() int {
 	return h.N() + h.P()*2
 }
 
+// Total returns the count of all triangles, textured and untextured, after
+// quads have been split.
+func (h meshHeader) Total() int {
+	return h.TT() + h.Q() + h.R()*2
+}
+
+// Polygon is the FFT data of the polygon a triangle was read from that the
+// engine doesn't use. The parser keeps it in heretic.Triangle.Source so the
+// encoder can write the polygon back the way it was read.
+type Polygon struct {
+	// Code is the byte that follows the color of an untextured polygon.
+	// Its meaning isn't known.
+	Code uint8
+
+	// CLUT and Texpage are the attributes of a textured polygon as they
+	// were read. The encoder only changes the bits the triangle has its
+	// own values for: the palette, the page and the blending.
+	CLUT, Texpage uint16
+
+	// Normals are the vertex normals of a textured polygon, in the order
+	// of the triangle's points.
+	Normals []heretic.Vec3
+
+	// Quad is 1 for the first triangle of a split quad, 2 for the second
+	// and 0 for a triangle. The encoder writes the halves back as a quad.
+	Quad int
+}
+
 // Below are types that the ISO file contains. We use them to read the data and
 // turn them into native engine types.
 //
@@ -116,10 +241,19 @@ func (q quad) split() []heretic.Triangle {
 	}
 }
 
+// splitNormals splits the vertex normals of a quad the same way as the points.
+func splitNormals(n []heretic.Vec3) [][]heretic.Vec3 {
+	return [][]heretic.Vec3{{n[0], n[1], n[2]}, {n[1], n[3], n[2]}}
+}
+
 // This can be for a triangle or a quad, depending on the len of texCoords.
 type textureData struct {
 	texCoords []heretic.Tex
 	palette   int
+	blendMode heretic.BlendMode
+
+	// The attributes as they were read.
+	clut, texpage uint16
 }
 
 // split will split quad textures data into two separate textureDatas (one for
@@ -129,8 +263,8 @@ func (q textureData) split() []textureData {
 		panic("expected 4 texture coordinates")
 	}
 	qt := q.texCoords
-	return []textureData{
-		{texCoords: []heretic.Tex{qt[0], qt[1], qt[2]}, palette: q.palette},
-		{texCoords: []heretic.Tex{qt[1], qt[3], qt[2]}, palette: q.palette},
-	}
+	a, b := q, q
+	a.texCoords = []heretic.Tex{qt[0], qt[1], qt[2]}
+	b.texCoords = []heretic.Tex{qt[1], qt[3], qt[2]}
+	return []textureData{a, b}
 }
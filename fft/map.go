@@ -6,182 +6,638 @@
 package fft
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"sort"
 
 	"github.com/adamrt/heretic"
 )
 
-func NewMeshReader(iso ISOReader) MeshReader {
-	return MeshReader{iso}
+// NewMeshReader returns a MeshReader for the source. Both an ISOReader and a
+// DirSource can be used.
+func NewMeshReader(source MapSource) MeshReader {
+	return MeshReader{source}
 }
 
 type MeshReader struct {
-	iso ISOReader
+	source MapSource
 }
 
-func (r MeshReader) ReadMesh(mapNum int) heretic.Mesh {
-	records := r.readGNSRecords(mapNum)
+// Map is a fully parsed map. Mesh is what the engine renders. The rest is FFT
+// specific data that doesn't have an engine equivalent.
+type Map struct {
+	Mesh     heretic.Mesh
+	Palettes []heretic.Palette
+	Terrain  Terrain
 
-	textures := []heretic.Texture{}
-	mesh := heretic.Mesh{}
-	for _, record := range records {
-		if record.Type() == RecordTypeTexture {
-			texture := r.parseTexture(record)
-			textures = append(textures, texture)
-		} else if record.Type() == RecordTypeMeshPrimary {
-			mesh = r.parseMesh(record)
-		} else if record.Type() == RecordTypeMeshAlt {
-			// Sometimes there is no primary mesh (ie MAP002.GNS),
-			// there is only an alternate. I'm not sure why. So we
-			// treat this one as the primary, only if the primary
-			// hasn't been set. Kinda Hacky until we start treating
-			// each GNS Record as a Scenario.
-			if len(mesh.Triangles) == 0 {
-				mesh = r.parseMesh(record)
-			}
+	// GrayPalettes are used by the game in place of Palettes for some
+	// effects. Not every map has them.
+	GrayPalettes []heretic.Palette
+
+	// unparsed are the sections of the mesh file that aren't read, like
+	// the animations, by their header pointer. EncodeMesh writes them
+	// back as they were read.
+	unparsed map[int32][]byte
+}
+
+// Texture returns the map's texture and false if it doesn't have one, like
+// maps read with ParseMesh.
+func (m Map) Texture() (heretic.IndexedTexture, bool) {
+	t, ok := m.Mesh.Texture.(heretic.IndexedTexture)
+	return t, ok
+}
+
+// ReadMesh reads a map in the specified time/weather state. Records that
+// don't exist for the state fall back to the DefaultMapState records. It exits
+// if the map can't be read, use ReadMap to handle the error.
+func (r MeshReader) ReadMesh(mapNum int, state MapState) heretic.Mesh {
+	m, err := r.ReadMap(mapNum, state)
+	if err != nil {
+		log.Fatalf("read map %d: %v", mapNum, err)
+	}
+	return m.Mesh
+}
+
+// ReadMap reads a map in the specified time/weather state, including the
+// terrain and palettes. The mesh coordinates are normalized and centered for
+// the engine.
+func (r MeshReader) ReadMap(mapNum int, state MapState) (Map, error) {
+	return r.ReadMapContext(context.Background(), mapNum, state)
+}
+
+// ReadMapContext is like ReadMap, but stops before reading each of the map's
+// files once ctx is cancelled and returns ctx.Err().
+func (r MeshReader) ReadMapContext(ctx context.Context, mapNum int, state MapState) (Map, error) {
+	m, err := r.readMapRaw(ctx, mapNum, state)
+	if err != nil {
+		return Map{}, err
+	}
+	m.Mesh.NormalizeCoordinates()
+	m.Mesh.CenterCoordinates()
+	return m, nil
+}
+
+// ReadMapRaw is like ReadMap but leaves the mesh in FFT coordinates. This is
+// what EncodeMesh expects.
+//
+// The primary mesh record is read first. If there is an override record for
+// the state, the sections it contains replace those of the primary mesh.
+func (r MeshReader) ReadMapRaw(mapNum int, state MapState) (Map, error) {
+	return r.readMapRaw(context.Background(), mapNum, state)
+}
+
+func (r MeshReader) readMapRaw(ctx context.Context, mapNum int, state MapState) (Map, error) {
+	if err := ctx.Err(); err != nil {
+		return Map{}, err
+	}
+	records, err := r.readGNSRecords(mapNum)
+	if err != nil {
+		return Map{}, err
+	}
+	state = state.normalize()
+
+	sections := meshSections{}
+
+	// Sometimes there is no primary mesh (ie MAP002.GNS), there is only an
+	// alternate. I'm not sure why. So we treat the alternate as the
+	// primary, only if the primary doesn't exist.
+	meshRecord := selectRecord(records, RecordTypeMeshPrimary, state)
+	if meshRecord == nil {
+		meshRecord = selectRecord(records, RecordTypeMeshAlt, state)
+	}
+	if meshRecord != nil {
+		if err := ctx.Err(); err != nil {
+			return Map{}, err
+		}
+		sections, err = r.parseMesh(mapNum, meshRecord)
+		if err != nil {
+			return Map{}, fmt.Errorf("parse mesh: %w", err)
+		}
+	}
+
+	// Overrides are specific to a state. Only an override for exactly this
+	// state is applied, the default state's changes don't belong to the
+	// night and weather states.
+	if overrideRecord := findRecord(records, RecordTypeMeshOverride, state); overrideRecord != nil {
+		if err := ctx.Err(); err != nil {
+			return Map{}, err
+		}
+		override, err := r.parseMesh(mapNum, overrideRecord)
+		if err != nil {
+			return Map{}, fmt.Errorf("parse mesh override: %w", err)
+		}
+		sections.override(override)
+	}
+
+	m, err := sections.build()
+	if err != nil {
+		return Map{}, err
+	}
+
+	if textureRecord := selectRecord(records, RecordTypeTexture, state); textureRecord != nil {
+		if err := ctx.Err(); err != nil {
+			return Map{}, err
 		}
+		texture, err := r.parseTexture(mapNum, textureRecord)
+		if err != nil {
+			return Map{}, fmt.Errorf("parse texture: %w", err)
+		}
+		m.Mesh.Texture = texture
+	}
+
+	m.Mesh.Scale = heretic.Vec3{X: 1, Y: 1, Z: 1}
+	return m, nil
+}
+
+// MapStates returns every time/weather state the map provides records for,
+// ordered by time and then weather.
+func (r MeshReader) MapStates(mapNum int) ([]MapState, error) {
+	records, err := r.readGNSRecords(mapNum)
+	if err != nil {
+		return nil, err
 	}
+	return recordStates(records), nil
+}
 
-	mesh.Scale = heretic.Vec3{X: 1, Y: 1, Z: 1}
-	mesh.Texture = textures[0]
+// ReadMeshState reads a map using an index into MapStates(). This lets the
+// engine cycle through states without knowing about fft types.
+func (r MeshReader) ReadMeshState(mapNum int, stateIdx int) heretic.Mesh {
+	states, err := r.MapStates(mapNum)
+	if err != nil {
+		log.Fatalf("read map %d states: %v", mapNum, err)
+	}
+	if stateIdx < 0 || stateIdx >= len(states) {
+		return r.ReadMesh(mapNum, DefaultMapState)
+	}
+	return r.ReadMesh(mapNum, states[stateIdx])
+}
 
-	mesh.NormalizeCoordinates()
-	mesh.CenterCoordinates()
-	return mesh
+// NumMapStates returns the number of states the map provides.
+func (r MeshReader) NumMapStates(mapNum int) int {
+	states, err := r.MapStates(mapNum)
+	if err != nil {
+		log.Fatalf("read map %d states: %v", mapNum, err)
+	}
+	return len(states)
 }
 
-func (r MeshReader) readGNSRecords(mapNum int) []GNSRecord {
-	sector := GNSSectors[mapNum]
-	r.iso.seekSector(sector)
+// selectRecord returns the first record of the type that matches the state. If
+// there isn't one, it falls back to the DefaultMapState record and then to the
+// first record of the type. It returns nil if there is no record of the type.
+func selectRecord(records []GNSRecord, typ RecordType, state MapState) GNSRecord {
+	if record := findRecord(records, typ, state); record != nil {
+		return record
+	}
+	if record := findRecord(records, typ, DefaultMapState); record != nil {
+		return record
+	}
+	for _, record := range records {
+		if record.Type() == typ {
+			return record
+		}
+	}
+	return nil
+}
 
-	records := []GNSRecord{}
-	for {
-		record := make(GNSRecord, GNSRecordLen)
-		n, err := r.iso.file.Read(record)
-		if err != nil || n != GNSRecordLen {
-			log.Fatalf("read gns record: %v", err)
+// findRecord returns the first record of the type that matches the state
+// exactly, or nil if there isn't one.
+func findRecord(records []GNSRecord, typ RecordType, state MapState) GNSRecord {
+	for _, record := range records {
+		if record.Type() == typ && record.State() == state {
+			return record
 		}
-		if record.Type() == RecordTypeEnd {
-			break
+	}
+	return nil
+}
+
+// recordStates returns the unique states of the records, sorted by time and
+// then weather.
+func recordStates(records []GNSRecord) []MapState {
+	seen := map[MapState]bool{}
+	states := []MapState{}
+	for _, record := range records {
+		state := record.State()
+		if seen[state] {
+			continue
 		}
-		records = append(records, record)
+		seen[state] = true
+		states = append(states, state)
 	}
-	return records
+	sort.Slice(states, func(i, j int) bool { return states[i].less(states[j]) })
+	return states
 }
 
-// parseTexture reads and returns an FFT texture as an engine Texture.
-func (r MeshReader) parseTexture(record GNSRecord) heretic.Texture {
-	r.iso.seekSector(record.Sector())
-	data := make([]byte, record.Len())
-	n, err := r.iso.file.Read(data)
-	if err != nil || int64(n) != record.Len() {
-		log.Fatalf("read texture data: %v", err)
+// readGNSRecords reads the map's GNS file. At most gnsMaxLen bytes are read,
+// the end record has to be within them.
+func (r MeshReader) readGNSRecords(mapNum int) ([]GNSRecord, error) {
+	gns, err := r.source.GNS(mapNum)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, gnsMaxLen)
+	n, err := gns.ReadAt(data, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read gns: %w", err)
 	}
-	pixels := textureSplitPixels(data)
-	return heretic.NewTexture(textureWidth, textureHeight, pixels)
+	return ParseGNS(data[:n])
 }
 
-// parseMesh reads mesh data for primary and alternate meshes.
-//
-func (r MeshReader) parseMesh(record GNSRecord) heretic.Mesh {
-	r.iso.seekSector(record.Sector())
+// maxResourceLen is the largest resource that is read. The PlayStation only
+// has 2MB of RAM, so no real resource comes close. It keeps a corrupt record
+// length from allocating gigabytes.
+const maxResourceLen = 2 << 20
 
-	// File header contains intra-file pointers to areas of mesh data.
-	fileHeader := make(meshFileHeader, meshFileHeaderLen)
-	n, err := r.iso.file.Read(fileHeader)
-	if err != nil || int64(n) != meshFileHeaderLen {
-		log.Fatalf("read mesh file header: %v", err)
+// readResource reads the whole file the record points to.
+func (r MeshReader) readResource(mapNum int, record GNSRecord) ([]byte, error) {
+	if record.Len() > maxResourceLen {
+		return nil, fmt.Errorf("record length %d is more than the maximum of %d", record.Len(), maxResourceLen)
+	}
+	data, err := r.source.Resource(mapNum, record)
+	if err != nil {
+		return nil, err
+	}
+	dr := newDataReader(data, 0)
+	raw := dr.readBytes(int(record.Len()))
+	if dr.err != nil {
+		return nil, dr.err
+	}
+	return raw, nil
+}
+
+// parseTexture reads and returns an FFT texture as an engine texture.
+func (r MeshReader) parseTexture(mapNum int, record GNSRecord) (heretic.IndexedTexture, error) {
+	data, err := r.readResource(mapNum, record)
+	if err != nil {
+		return heretic.IndexedTexture{}, err
+	}
+	return ParseTexture(data)
+}
+
+// ParseTexture parses the data a texture record points to. The texture is
+// 4bpp, two palette indexes per byte, and is drawn with each triangle's
+// palette.
+func ParseTexture(data []byte) (heretic.IndexedTexture, error) {
+	if len(data) < textureRawLen {
+		return heretic.IndexedTexture{}, fmt.Errorf("texture is %d bytes, expected %d", len(data), textureRawLen)
+	}
+	pix := make([]byte, textureRawLen)
+	copy(pix, data)
+	return heretic.NewIndexedTexture(textureWidth, textureHeight, 4, pix, nil), nil
+}
+
+// meshSections are the parts of a mesh record that can be replaced by an
+// override record. A nil section wasn't present in the record (its pointer was
+// zero).
+type meshSections struct {
+	palettes     []heretic.Palette
+	grayPalettes []heretic.Palette
+
+	// triangles and paletteIdxs are parallel slices. The palette is looked
+	// up once all sections are known, since an override can replace the
+	// palettes without replacing the polygons.
+	triangles   []heretic.Triangle
+	paletteIdxs []int
+
+	lights  *lightsAndBackground
+	terrain *Terrain
+
+	// unparsed only has the sections that were in the record.
+	unparsed map[int32][]byte
+}
+
+// lightsAndBackgroundLen is the length in bytes of the section: 9 light color
+// components, 3 light positions, the ambient color and 2 background colors.
+const lightsAndBackgroundLen = 9*2 + 3*6 + 3 + 2*3
+
+type lightsAndBackground struct {
+	directional []heretic.DirectionalLight
+	ambient     heretic.AmbientLight
+	background  heretic.Background
+}
+
+// override replaces any section that exists in o.
+func (s *meshSections) override(o meshSections) {
+	if o.palettes != nil {
+		s.palettes = o.palettes
+	}
+	if o.grayPalettes != nil {
+		s.grayPalettes = o.grayPalettes
+	}
+	if o.triangles != nil {
+		s.triangles = o.triangles
+		s.paletteIdxs = o.paletteIdxs
+	}
+	if o.lights != nil {
+		s.lights = o.lights
+	}
+	if o.terrain != nil {
+		s.terrain = o.terrain
+	}
+	for ptr, data := range o.unparsed {
+		if s.unparsed == nil {
+			s.unparsed = map[int32][]byte{}
+		}
+		s.unparsed[ptr] = data
+	}
+}
+
+// build turns the sections into a Map, resolving each triangle's palette. An
+// error is returned if a triangle uses a palette that doesn't exist.
+func (s meshSections) build() (Map, error) {
+	for i := range s.triangles {
+		// Untextured triangles have an index of -1.
+		if idx := s.paletteIdxs[i]; idx >= 0 {
+			if idx >= len(s.palettes) {
+				return Map{}, fmt.Errorf("triangle %d uses palette %d, there are %d palettes", i, idx, len(s.palettes))
+			}
+			s.triangles[i].Palette = s.palettes[idx]
+		}
+	}
+
+	m := Map{
+		Mesh:         heretic.Mesh{Triangles: s.triangles},
+		Palettes:     s.palettes,
+		GrayPalettes: s.grayPalettes,
+		unparsed:     s.unparsed,
+	}
+	if s.lights != nil {
+		background := s.lights.background
+		m.Mesh.Background = &background
+		m.Mesh.DirectionalLights = s.lights.directional
+		m.Mesh.AmbientLight = s.lights.ambient
+	}
+	if s.terrain != nil {
+		m.Terrain = *s.terrain
+	}
+	return m, nil
+}
+
+// parseMesh reads the sections of primary, alternate and override mesh
+// records.
+func (r MeshReader) parseMesh(mapNum int, record GNSRecord) (meshSections, error) {
+	data, err := r.readResource(mapNum, record)
+	if err != nil {
+		return meshSections{}, err
+	}
+	if len(data) < meshFileHeaderLen {
+		return meshSections{}, fmt.Errorf("mesh is %d bytes, shorter than the header", len(data))
 	}
 
 	// Primary mesh pointer tells us where the primary mesh data is.  I
 	// think this is always 196 as it starts directly after the header,
-	// which has a size of 196. Keep dynamic here as pointer access will
-	// grow and this keeps it consistent.
-	primaryMeshPointer := fileHeader.PrimaryMesh()
-
+	// which has a size of 196.
+	//
 	// Previously we did these pointer checks on every map. But some maps
-	// (ie MAP002.GNS) don't have a primary mesh, only alternative. The location of that mesh
+	// (ie MAP002.GNS) don't have a primary mesh, only alternative. The
+	// location of that mesh is the same though. Override records often
+	// don't have a mesh at all.
 	if record.Type() == RecordTypeMeshPrimary {
+		primaryMeshPointer := meshFileHeader(data).PrimaryMesh()
 		if primaryMeshPointer == 0 || primaryMeshPointer != 196 {
-			log.Fatal("missing primary mesh pointer")
+			return meshSections{}, errors.New("missing primary mesh pointer")
+		}
+	}
+
+	return parseMeshSections(data)
+}
+
+// ParseMesh parses the data a mesh record points to. The map is in FFT
+// coordinates, like ReadMapRaw, but has no texture since that is a separate
+// record. Sections that aren't in the data are left empty.
+func ParseMesh(data []byte) (Map, error) {
+	sections, err := parseMeshSections(data)
+	if err != nil {
+		return Map{}, err
+	}
+	m, err := sections.build()
+	if err != nil {
+		return Map{}, err
+	}
+	m.Mesh.Scale = heretic.Vec3{X: 1, Y: 1, Z: 1}
+	return m, nil
+}
+
+// parseMeshSections reads the sections of a mesh file. Only sections with a
+// non-zero pointer are read. Every section is checked to be within the data
+// before it is read, and the polygon counts are checked before anything is
+// allocated for them.
+func parseMeshSections(data []byte) (meshSections, error) {
+	if len(data) < meshFileHeaderLen {
+		return meshSections{}, fmt.Errorf("mesh is %d bytes, shorter than the header", len(data))
+	}
+
+	// File header contains intra-file pointers to areas of mesh data.
+	fileHeader := meshFileHeader(data[:meshFileHeaderLen])
+
+	// section returns a reader for the n bytes at the pointer.
+	section := func(name string, ptr int64, n int64) (*dataReader, error) {
+		if ptr < meshFileHeaderLen || ptr+n > int64(len(data)) {
+			return nil, fmt.Errorf("%s: %d bytes at %d is outside of the %d byte mesh", name, n, ptr, len(data))
+		}
+		return newDataReader(bytes.NewReader(data), ptr), nil
+	}
+
+	sections := meshSections{}
+
+	if ptr := fileHeader.TexturePalettesColor(); ptr != 0 {
+		dr, err := section("palettes", ptr, palettesLen)
+		if err != nil {
+			return meshSections{}, err
+		}
+		sections.palettes = readPalettes(dr)
+		if dr.err != nil {
+			return meshSections{}, fmt.Errorf("read palettes: %w", dr.err)
+		}
+	}
+
+	if ptr := fileHeader.TexturePalettesGray(); ptr != 0 {
+		dr, err := section("gray palettes", ptr, palettesLen)
+		if err != nil {
+			return meshSections{}, err
+		}
+		sections.grayPalettes = readPalettes(dr)
+		if dr.err != nil {
+			return meshSections{}, fmt.Errorf("read gray palettes: %w", dr.err)
+		}
+	}
+
+	if ptr := fileHeader.PrimaryMesh(); ptr != 0 {
+		if _, err := section("mesh header", ptr, meshHeaderLen); err != nil {
+			return meshSections{}, err
+		}
+		header := meshHeader(data[ptr : ptr+meshHeaderLen])
+		dr, err := section("polygons", ptr, meshHeaderLen+header.dataLen())
+		if err != nil {
+			return meshSections{}, err
+		}
+		sections.triangles, sections.paletteIdxs = readPolygons(dr)
+		if dr.err != nil {
+			return meshSections{}, fmt.Errorf("read polygons: %w", dr.err)
+		}
+	}
+
+	if ptr := fileHeader.LightsAndBackground(); ptr != 0 {
+		dr, err := section("lights", ptr, lightsAndBackgroundLen)
+		if err != nil {
+			return meshSections{}, err
+		}
+		sections.lights = &lightsAndBackground{
+			directional: dr.readDirectionalLights(),
+			ambient:     dr.readAmbientLight(),
+			background:  dr.readBackground(),
+		}
+		if dr.err != nil {
+			return meshSections{}, fmt.Errorf("read lights: %w", dr.err)
+		}
+	}
+
+	if ptr := fileHeader.Terrain(); ptr != 0 {
+		dr, err := section("terrain", ptr, terrainLen)
+		if err != nil {
+			return meshSections{}, err
+		}
+		terrain := dr.readTerrain()
+		if dr.err != nil {
+			return meshSections{}, fmt.Errorf("read terrain: %w", dr.err)
+		}
+		sections.terrain = &terrain
+	}
+
+	for _, p := range unparsedPointers {
+		ptr := fileHeader.ptr(p)
+		if ptr == 0 {
+			continue
 		}
+		if _, err := section("unparsed section", ptr, 0); err != nil {
+			return meshSections{}, err
+		}
+		if sections.unparsed == nil {
+			sections.unparsed = map[int32][]byte{}
+		}
+		end := fileHeader.sectionEnd(ptr, int64(len(data)))
+		sections.unparsed[p] = append([]byte{}, data[ptr:end]...)
 	}
 
-	// Skip ahead to color palettes
-	r.iso.seekPointer(record.Sector(), fileHeader.TexturePalettesColor())
+	return sections, nil
+}
 
+// palettesLen is the length in bytes of the 16 palettes of 16 RGB15 colors.
+const palettesLen = 16 * 16 * 2
+
+// readPalettes reads the 16 palettes of 16 colors each.
+func readPalettes(dr *dataReader) []heretic.Palette {
 	palettes := make([]heretic.Palette, 16)
 	for i := 0; i < 16; i++ {
 		palette := make(heretic.Palette, 16)
 		for j := 0; j < 16; j++ {
-			palette[j] = r.iso.readRGB15()
+			palette[j] = dr.readRGB15()
 		}
 		palettes[i] = palette
 	}
+	return palettes
+}
 
-	// Seek to the mesh data.
-	r.iso.seekPointer(record.Sector(), primaryMeshPointer)
-
+// readPolygons reads the mesh header and polygon data. It returns the
+// triangles and the palette index of each triangle. Untextured triangles have a
+// palette index of -1.
+func readPolygons(dr *dataReader) ([]heretic.Triangle, []int) {
 	// Mesh header contains the number of triangles and quads that exist.
-	header := make(meshHeader, meshHeaderLen)
-	n, err = r.iso.file.Read(header)
-	if err != nil || int64(n) != meshHeaderLen {
-		log.Fatalf("read mesh file header: %v", err)
-	}
+	header := meshHeader(dr.readBytes(meshHeaderLen))
 
-	// FIXME: Change capacity from TT to total with untextured.
-	triangles := make([]heretic.Triangle, 0, header.TT())
+	triangles := make([]heretic.Triangle, 0, header.Total())
 	for i := 0; i < header.N(); i++ {
-		triangles = append(triangles, r.iso.readTriangle())
+		triangles = append(triangles, dr.readTriangle())
 	}
 	for i := 0; i < header.P(); i++ {
-		triangles = append(triangles, r.iso.readQuad().split()...)
+		triangles = append(triangles, dr.readQuad().split()...)
 	}
 	for i := 0; i < header.Q(); i++ {
-		triangles = append(triangles, r.iso.readTriangle())
+		triangles = append(triangles, dr.readTriangle())
 	}
 	for i := 0; i < header.R(); i++ {
-		triangles = append(triangles, r.iso.readQuad().split()...)
+		triangles = append(triangles, dr.readQuad().split()...)
+	}
+
+	// The FFT data of each triangle that the engine doesn't use. Split
+	// quads are marked so they can be written back as quads.
+	sources := make([]Polygon, len(triangles))
+	for i := header.N(); i < header.TT(); i = i + 2 {
+		sources[i].Quad, sources[i+1].Quad = 1, 2
+	}
+	for i := header.TT() + header.Q(); i < len(triangles); i = i + 2 {
+		sources[i].Quad, sources[i+1].Quad = 1, 2
 	}
 
-	// Normals
-	// Nothing is actually collected. They are just read here so the
-	// iso read position moves forward, so we can read polygon texture data
-	// next.  This could be cleaned up as a seek, but we may eventually use
-	// the normal data here.
+	// Normals of the textured polygons. The engine lights with face
+	// normals, these are only kept for encoding.
 	for i := 0; i < header.N(); i++ {
-		r.iso.readTriNormal()
+		sources[i].Normals = dr.readTriNormal()
 	}
-	for i := 0; i < header.P(); i++ {
-		r.iso.readQuadNormal()
+	for i := header.N(); i < header.TT(); i = i + 2 {
+		normals := splitNormals(dr.readQuadNormal())
+		sources[i].Normals = normals[0]
+		sources[i+1].Normals = normals[1]
+	}
+
+	paletteIdxs := make([]int, len(triangles))
+	for i := range paletteIdxs {
+		paletteIdxs[i] = -1
 	}
 
 	// Polygon texture data
 	for i := 0; i < header.N(); i++ {
-		uvData := r.iso.readTriUV()
-		triangles[i].Texcoords = uvData.texCoords
-		triangles[i].Palette = palettes[uvData.palette]
+		paletteIdxs[i] = setTextureData(&triangles[i], &sources[i], dr.readTriUV())
 	}
 	for i := header.N(); i < header.TT(); i = i + 2 {
-		uvDatas := r.iso.readQuadUV().split()
-		triangles[i].Texcoords = uvDatas[0].texCoords
-		triangles[i].Palette = palettes[uvDatas[0].palette]
-
-		triangles[i+1].Texcoords = uvDatas[1].texCoords
-		triangles[i+1].Palette = palettes[uvDatas[1].palette]
+		uvDatas := dr.readQuadUV().split()
+		paletteIdxs[i] = setTextureData(&triangles[i], &sources[i], uvDatas[0])
+		paletteIdxs[i+1] = setTextureData(&triangles[i+1], &sources[i+1], uvDatas[1])
 	}
 
-	// Skip ahead to lights
-	r.iso.seekPointer(record.Sector(), fileHeader.LightsAndBackground())
+	// Untextured polygon data, triangles first then quads. Untextured
+	// polygons are drawn with the color it seems to hold. Both halves of
+	// a split quad get the same data.
+	for i := header.TT(); i < len(triangles); {
+		c, code := dr.readUntexturedData()
+		n := 1
+		if i >= header.TT()+header.Q() {
+			n = 2
+		}
+		for j := i; j < i+n; j++ {
+			triangles[j].Color = c
+			sources[j].Code = code
+		}
+		i += n
+	}
 
-	directionalLights := r.iso.readDirectionalLights()
-	ambientLight := r.iso.readAmbientLight()
-	background := r.iso.readBackground()
+	// Terrain tile locations for textured polygons. Both halves of a
+	// split quad sit on the same tile.
+	for i := 0; i < header.N(); i++ {
+		triangles[i].Tile = dr.readTileLocation()
+	}
+	for i := header.N(); i < header.TT(); i = i + 2 {
+		loc := dr.readTileLocation()
+		triangles[i].Tile = loc
+		triangles[i+1].Tile = loc
+	}
 
-	return heretic.Mesh{
-		Triangles:         triangles,
-		Background:        &background,
-		DirectionalLights: directionalLights,
-		AmbientLight:      ambientLight,
+	for i := range triangles {
+		triangles[i].Source = sources[i]
 	}
+	return triangles, paletteIdxs
+}
+
+// setTextureData sets the texture of the triangle and returns its palette
+// index.
+func setTextureData(t *heretic.Triangle, src *Polygon, data textureData) int {
+	t.Texcoords = data.texCoords
+	t.Textured = true
+	t.BlendMode = data.blendMode
+	src.CLUT = data.clut
+	src.Texpage = data.texpage
+	return data.palette
 }
@@ -0,0 +1,338 @@
+package fft
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/adamrt/heretic"
+)
+
+// compareMaps reports the differences between the sections of two maps in FFT
+// coordinates.
+func compareMaps(t *testing.T, got, want Map) {
+	t.Helper()
+
+	if len(got.Mesh.Triangles) != len(want.Mesh.Triangles) {
+		t.Fatalf("got %d triangles, want %d", len(got.Mesh.Triangles), len(want.Mesh.Triangles))
+	}
+	for i := range want.Mesh.Triangles {
+		g, w := got.Mesh.Triangles[i], want.Mesh.Triangles[i]
+		if !reflect.DeepEqual(g.Points, w.Points) {
+			t.Errorf("triangle %d: points = %v, want %v", i, g.Points, w.Points)
+		}
+		if !reflect.DeepEqual(g.Texcoords, w.Texcoords) {
+			t.Errorf("triangle %d: texcoords = %v, want %v", i, g.Texcoords, w.Texcoords)
+		}
+		if g.Textured != w.Textured || g.BlendMode != w.BlendMode || g.Color != w.Color {
+			t.Errorf("triangle %d: textured/blend/color = %v/%v/%v, want %v/%v/%v", i, g.Textured, g.BlendMode, g.Color, w.Textured, w.BlendMode, w.Color)
+		}
+		if !palettesEqual(g.Palette, w.Palette) {
+			t.Errorf("triangle %d: wrong palette", i)
+		}
+		if !reflect.DeepEqual(g.Tile, w.Tile) {
+			t.Errorf("triangle %d: tile = %v, want %v", i, g.Tile, w.Tile)
+		}
+		if !reflect.DeepEqual(g.Source, w.Source) {
+			t.Errorf("triangle %d: source = %+v, want %+v", i, g.Source, w.Source)
+		}
+	}
+
+	if !reflect.DeepEqual(got.Palettes, want.Palettes) {
+		t.Error("palettes differ")
+	}
+	if !reflect.DeepEqual(got.GrayPalettes, want.GrayPalettes) {
+		t.Error("gray palettes differ")
+	}
+	// Only the tiles are compared, a terrain that was read has its
+	// section too.
+	gotTerrain, wantTerrain := got.Terrain, want.Terrain
+	gotTerrain.raw, wantTerrain.raw = nil, nil
+	if !reflect.DeepEqual(gotTerrain, wantTerrain) {
+		t.Errorf("terrain = %+v, want %+v", gotTerrain, wantTerrain)
+	}
+	if !reflect.DeepEqual(got.Mesh.DirectionalLights, want.Mesh.DirectionalLights) {
+		t.Errorf("directional lights = %v, want %v", got.Mesh.DirectionalLights, want.Mesh.DirectionalLights)
+	}
+	if got.Mesh.AmbientLight != want.Mesh.AmbientLight {
+		t.Errorf("ambient light = %v, want %v", got.Mesh.AmbientLight, want.Mesh.AmbientLight)
+	}
+	if !reflect.DeepEqual(got.Mesh.Background, want.Mesh.Background) {
+		t.Errorf("background = %v, want %v", got.Mesh.Background, want.Mesh.Background)
+	}
+	if !reflect.DeepEqual(got.Mesh.Texture, want.Mesh.Texture) {
+		t.Error("textures differ")
+	}
+	if !reflect.DeepEqual(got.unparsed, want.unparsed) {
+		t.Errorf("unparsed sections = %v, want %v", got.unparsed, want.unparsed)
+	}
+}
+
+func TestReadMapRaw(t *testing.T) {
+	for name, image := range testImages(t) {
+		t.Run(name, func(t *testing.T) {
+			m, err := testReader(t, image).ReadMapRaw(testMapNum, DefaultMapState)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareMaps(t, m, testMap())
+		})
+	}
+}
+
+func TestReadMapStates(t *testing.T) {
+	r := testReader(t, testImages(t)["iso"])
+
+	states, err := r.MapStates(testMapNum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []MapState{DefaultMapState, testNight}; !reflect.DeepEqual(states, want) {
+		t.Errorf("states = %v, want %v", states, want)
+	}
+
+	// The night state has its own mesh and the override replaces its
+	// terrain.
+	night, err := r.ReadMapRaw(testMapNum, testNight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if night.Mesh.AmbientLight != testNightMap().Mesh.AmbientLight {
+		t.Errorf("night ambient light = %v", night.Mesh.AmbientLight)
+	}
+	if h := night.Terrain.Tile(0, 0, 0).Height; h != 99 {
+		t.Errorf("night terrain height = %d, want the override's 99", h)
+	}
+
+	// A state without records falls back to the default records.
+	strong, err := r.ReadMapRaw(testMapNum, MapState{Time: TimeDay, Weather: WeatherStrong})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareMaps(t, strong, testMap())
+}
+
+func TestReadMapOverrideState(t *testing.T) {
+	// An override of the default state isn't applied to other states.
+	disc := newFixtureDisc()
+	if err := disc.AddMap(testMapNum, DefaultMapState, testMap()); err != nil {
+		t.Fatal(err)
+	}
+	if err := disc.AddMap(testMapNum, testNight, testNightMap()); err != nil {
+		t.Fatal(err)
+	}
+	disc.AddResource(testMapNum, RecordTypeMeshOverride, DefaultMapState, testOverride(t))
+	iso, err := disc.ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := testReader(t, iso)
+
+	day, err := r.ReadMapRaw(testMapNum, DefaultMapState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := day.Terrain.Tile(0, 0, 0).Height; h != 99 {
+		t.Errorf("day terrain height = %d, want the override's 99", h)
+	}
+	night, err := r.ReadMapRaw(testMapNum, testNight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, want := night.Terrain.Tile(0, 0, 0).Height, testNightMap().Terrain.Tile(0, 0, 0).Height; h != want {
+		t.Errorf("night terrain height = %d, want %d without the day override", h, want)
+	}
+}
+
+func TestReadMapAlt(t *testing.T) {
+	m, err := testReader(t, testImages(t)["iso"]).ReadMapRaw(testAltMapNum, DefaultMapState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testMap()
+	want.Mesh.Texture = nil
+	compareMaps(t, m, want)
+}
+
+func TestReadMapNormalized(t *testing.T) {
+	m, err := testReader(t, testImages(t)["iso"]).ReadMap(testMapNum, DefaultMapState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tri := range m.Mesh.Triangles {
+		for _, p := range tri.Points {
+			if p.X < -1 || p.X > 1 || p.Y < -1 || p.Y > 1 || p.Z < -1 || p.Z > 1 {
+				t.Fatalf("point %v is outside of -1..1", p)
+			}
+		}
+	}
+}
+
+func TestReadMapMissing(t *testing.T) {
+	r := testReader(t, testImages(t)["iso"])
+	if _, err := r.ReadMap(0, DefaultMapState); err == nil {
+		t.Error("expected an error for a map that isn't on the disc")
+	}
+	if _, err := r.ReadMap(len(DiscUS.GNSSectors), DefaultMapState); err == nil {
+		t.Error("expected an error for a map number out of range")
+	}
+}
+
+func TestParseMesh(t *testing.T) {
+	data, err := EncodeMesh(testMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseMesh(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testMap()
+	want.Mesh.Texture = nil
+	compareMaps(t, m, want)
+}
+
+func TestEncodeMeshEditedQuad(t *testing.T) {
+	m := testMap()
+	// Moving a shared point in one half means the halves aren't a quad
+	// anymore.
+	m.Mesh.Triangles[4].Points[0] = heretic.Vec3{X: 90, Y: -8, Z: 0}
+	// Triangles that weren't read from a map get face normals.
+	m.Mesh.Triangles[0].Source = nil
+
+	data, err := EncodeMesh(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := meshHeader(data[meshFileHeaderLen:])
+	if header.N() != 5 || header.P() != 0 || header.Q() != 1 || header.R() != 1 {
+		t.Fatalf("counts = %d %d %d %d, want 5 0 1 1", header.N(), header.P(), header.Q(), header.R())
+	}
+
+	got, err := ParseMesh(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Mesh.Triangles[4].Points, m.Mesh.Triangles[4].Points) {
+		t.Errorf("points = %v, want %v", got.Mesh.Triangles[4].Points, m.Mesh.Triangles[4].Points)
+	}
+	face := triangleNormal(m.Mesh.Triangles[0])
+	if n := polygonSource(got.Mesh.Triangles[0]).Normals; !reflect.DeepEqual(n, []heretic.Vec3{face, face, face}) {
+		t.Errorf("normals = %v, want the face normal", n)
+	}
+}
+
+func TestParseMeshBounds(t *testing.T) {
+	valid, err := EncodeMesh(testMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh := func(change func(data []byte)) []byte {
+		data := append([]byte{}, valid...)
+		change(data)
+		return data
+	}
+
+	tests := map[string][]byte{
+		"short header": valid[:meshFileHeaderLen-1],
+		"pointer into header": mesh(func(data []byte) {
+			meshFileHeader(data).setPtr(ptrTerrain, 4)
+		}),
+		"pointer past end": mesh(func(data []byte) {
+			meshFileHeader(data).setPtr(ptrLightsAndBackground, int64(len(data)))
+		}),
+		"section past end": mesh(func(data []byte) {
+			meshFileHeader(data).setPtr(ptrTerrain, int64(len(data)-terrainLen+1))
+		}),
+		"polygon counts": mesh(func(data []byte) {
+			ptr := meshFileHeader(data).PrimaryMesh()
+			copy(data[ptr:], newMeshHeader(0xFFFF, 0xFFFF, 0xFFFF, 0xFFFF))
+		}),
+		"terrain size": mesh(func(data []byte) {
+			ptr := meshFileHeader(data).Terrain()
+			data[ptr], data[ptr+1] = 17, 16
+		}),
+		"truncated": valid[:len(valid)-8],
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseMesh(data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseMeshPaletteIndex(t *testing.T) {
+	// Textured triangles without any palettes to use.
+	m := testMap()
+	m.Palettes = nil
+	for i := range m.Mesh.Triangles {
+		m.Mesh.Triangles[i].Palette = nil
+	}
+	data, err := EncodeMesh(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseMesh(data); err == nil {
+		t.Error("expected an error for a palette index without palettes")
+	}
+}
+
+func FuzzParseMesh(f *testing.F) {
+	valid, err := EncodeMesh(testMap())
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(valid)
+	f.Add(valid[:meshFileHeaderLen])
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := ParseMesh(data)
+		if err != nil {
+			return
+		}
+		// Every triangle needs at least 12 bytes of data, so the counts
+		// can't have allocated more than the data allows.
+		if len(m.Mesh.Triangles)*12 > len(data) {
+			t.Errorf("%d triangles from %d bytes", len(m.Mesh.Triangles), len(data))
+		}
+	})
+}
+
+func TestReadTriUVBlendMode(t *testing.T) {
+	tests := []struct {
+		texpage uint16
+		want    heretic.BlendMode
+	}{
+		// The mode bits alone don't make a polygon semi-transparent.
+		{0x0000, heretic.BlendModeOpaque},
+		{0x0060, heretic.BlendModeOpaque},
+		{texpageSemiTransparent, heretic.BlendModeAverage},
+		{texpageSemiTransparent | 0x0020, heretic.BlendModeAdd},
+		{texpageSemiTransparent | 0x0040, heretic.BlendModeSubtract},
+		{texpageSemiTransparent | 0x0060 | 3, heretic.BlendModeAddQuarter},
+	}
+	for _, tt := range tests {
+		w := &dataWriter{}
+		w.writeBytes([]byte{1, 2})
+		w.writeUint16(0x7805)
+		w.writeBytes([]byte{3, 4})
+		w.writeUint16(tt.texpage)
+		w.writeBytes([]byte{5, 6})
+
+		data := newDataReader(bytes.NewReader(w.Bytes()), 0).readTriUV()
+		if data.blendMode != tt.want {
+			t.Errorf("texpage %#04x: blend mode = %v, want %v", tt.texpage, data.blendMode, tt.want)
+		}
+		if data.palette != 5 || data.clut != 0x7805 || data.texpage != tt.texpage {
+			t.Errorf("texpage %#04x: palette/clut/texpage = %d/%#x/%#x", tt.texpage, data.palette, data.clut, data.texpage)
+		}
+
+		// Encoding keeps every bit.
+		out := &dataWriter{}
+		out.writeTriUV(data.texCoords, data.palette, data.blendMode, Polygon{CLUT: data.clut, Texpage: data.texpage})
+		if !bytes.Equal(out.Bytes(), w.Bytes()) {
+			t.Errorf("texpage %#04x: encoded % x, want % x", tt.texpage, out.Bytes(), w.Bytes())
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// This file contains the ability to write modified maps back into a disc image.
+//
+// Every resource a GNS record points to is a file in the MAP directory. New
+// data is written over the file's sectors, so it has to fit in the sectors
+// the file already has. Nothing else on the disc moves. After writing, the
+// size in the file's directory record and the length in the GNS records that
+// point to it are updated to match the new data.
+package fft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// mapDir is the directory on the disc with the GNS and resource files.
+const mapDir = "MAP"
+
+// WritableImage is a disc image that can be patched in place, such as an
+// *os.File opened for reading and writing.
+type WritableImage interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// DiscPatcher writes data into an ISO or raw BIN image. Patch a copy, the
+// image is changed in place.
+type DiscPatcher struct {
+	iso   ISOReader
+	image discImage
+}
+
+// NewDiscPatcher identifies the image. An error is returned if it isn't a known
+// version of the game.
+func NewDiscPatcher(image WritableImage) (DiscPatcher, error) {
+	img := newDiscImage(image)
+	iso, err := newISOReader(img)
+	if err != nil {
+		return DiscPatcher{}, err
+	}
+	return DiscPatcher{iso: iso, image: img}, nil
+}
+
+// Reader returns an ISOReader of the image being patched. It sees the patches
+// as soon as they are written.
+func (p DiscPatcher) Reader() ISOReader {
+	return p.iso
+}
+
+// PatchMap encodes the map and writes it over the state's primary mesh and
+// texture records. The map must be in FFT coordinates, as returned by
+// ReadMapRaw. The texture is only written if the map has one.
+//
+// Override records are left alone, so sections they contain still replace
+// those of the patched mesh when the map is read.
+//
+// The mesh is checked like PatchMesh does and both records are checked to fit
+// before either is written. If there is an error, nothing is written.
+func (p DiscPatcher) PatchMap(mapNum int, state MapState, m Map) error {
+	mesh, err := EncodeMesh(m)
+	if err != nil {
+		return fmt.Errorf("encode mesh: %w", err)
+	}
+	meshPatch, err := p.prepareMesh(mapNum, state, mesh)
+	if err != nil {
+		return fmt.Errorf("patch mesh: %w", err)
+	}
+	patches := []recordPatch{meshPatch}
+
+	if m.Mesh.Texture != nil {
+		indexed, ok := m.Texture()
+		if !ok {
+			return fmt.Errorf("texture is %T, not an indexed texture", m.Mesh.Texture)
+		}
+		texture, err := EncodeTexture(indexed)
+		if err != nil {
+			return fmt.Errorf("encode texture: %w", err)
+		}
+		texturePatch, err := p.prepare(mapNum, RecordTypeTexture, state, texture)
+		if err != nil {
+			return fmt.Errorf("patch texture: %w", err)
+		}
+		patches = append(patches, texturePatch)
+	}
+
+	for _, patch := range patches {
+		if err := p.write(patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PatchMesh writes an encoded mesh over the state's primary mesh record, like
+// PatchRecord. An error is returned, and nothing is written, if the mesh on the
+// disc has a section that the new one doesn't, like the animations of a map
+// that wasn't read with ReadMapRaw, or if the mesh on the disc has data that
+// EncodeMesh can't write back, which any mesh encoded from it would lose.
+func (p DiscPatcher) PatchMesh(mapNum int, state MapState, mesh []byte) error {
+	patch, err := p.prepareMesh(mapNum, state, mesh)
+	if err != nil {
+		return err
+	}
+	return p.write(patch)
+}
+
+func (p DiscPatcher) prepareMesh(mapNum int, state MapState, mesh []byte) (recordPatch, error) {
+	patch, err := p.prepare(mapNum, RecordTypeMeshPrimary, state, mesh)
+	if err != nil {
+		return recordPatch{}, err
+	}
+	current, err := NewMeshReader(p.iso).readResource(mapNum, patch.record)
+	if err != nil {
+		return recordPatch{}, fmt.Errorf("read mesh: %w", err)
+	}
+	if err := checkSectionsKept(current, mesh); err != nil {
+		return recordPatch{}, err
+	}
+	if err := checkReencodes(current); err != nil {
+		return recordPatch{}, err
+	}
+	return patch, nil
+}
+
+// checkSectionsKept returns an error if the current mesh file has a section,
+// or any other data in its header, that the new one doesn't.
+func checkSectionsKept(current, patched []byte) error {
+	if len(current) < meshFileHeaderLen {
+		return nil
+	}
+	before, after := meshFileHeader(current), meshFileHeader(patched)
+	for location := int32(0); location < meshFileHeaderLen; location += 4 {
+		if before.ptr(location) == 0 || after.ptr(location) != 0 {
+			continue
+		}
+		if name, ok := meshFilePointerName(location); ok {
+			return fmt.Errorf("the mesh has a %s section that would be lost", name)
+		}
+		return fmt.Errorf("the mesh has unknown header data at %#x that would be lost", location)
+	}
+	return nil
+}
+
+// checkReencodes returns an error if parsing and encoding the current mesh
+// file changes any of its sections, like light colors out of the range Map
+// holds. Sections may move, and the zeros that pad the end of a section
+// aren't compared.
+func checkReencodes(current []byte) error {
+	if len(current) < meshFileHeaderLen {
+		return nil
+	}
+	m, err := ParseMesh(current)
+	if err != nil {
+		return fmt.Errorf("read mesh: %w", err)
+	}
+	encoded, err := EncodeMesh(m)
+	if err != nil {
+		return fmt.Errorf("encode mesh: %w", err)
+	}
+	before, after := meshFileHeader(current), meshFileHeader(encoded)
+	for _, ptr := range meshFilePointers {
+		a := meshSection(current, before, ptr.location)
+		b := meshSection(encoded, after, ptr.location)
+		if !bytes.Equal(bytes.TrimRight(a, "\x00"), bytes.TrimRight(b, "\x00")) {
+			return fmt.Errorf("the mesh's %s section can't be written back as it is", ptr.name)
+		}
+	}
+	return nil
+}
+
+// meshSection returns the bytes of the section at the pointer location, or nil
+// if there is no section.
+func meshSection(data []byte, h meshFileHeader, location int32) []byte {
+	ptr := h.ptr(location)
+	if ptr == 0 || ptr > int64(len(data)) {
+		return nil
+	}
+	return data[ptr:h.sectionEnd(ptr, int64(len(data)))]
+}
+
+func meshFilePointerName(location int32) (string, bool) {
+	for _, p := range meshFilePointers {
+		if p.location == location {
+			return p.name, true
+		}
+	}
+	return "", false
+}
+
+// PatchRecord writes data over the file that the map's record of the type
+// and state points to. Only a record of exactly the state is patched, there
+// is no fallback to other states like when reading. Every record that points
+// to the same file, such as those of other states that share it, is updated.
+// The data isn't checked, use PatchMesh for meshes.
+//
+// An error is returned, and nothing is written, if the data doesn't fit in
+// the sectors of the original file or its location doesn't fit in the GNS
+// records.
+func (p DiscPatcher) PatchRecord(mapNum int, typ RecordType, state MapState, data []byte) error {
+	patch, err := p.prepare(mapNum, typ, state, data)
+	if err != nil {
+		return err
+	}
+	return p.write(patch)
+}
+
+// recordPatch is everything that is written to patch a record. It is made by
+// prepare, which checks it can be written, so several records can be checked
+// before any of them is written.
+type recordPatch struct {
+	record GNSRecord
+	file   isoFile
+	data   []byte
+	padded []byte
+
+	// records are the updated records, by their index in the GNS file.
+	gnsSector int64
+	records   map[int]GNSRecord
+}
+
+func (p DiscPatcher) prepare(mapNum int, typ RecordType, state MapState, data []byte) (recordPatch, error) {
+	gnsSec, err := gnsSector(p.iso.Version(), mapNum)
+	if err != nil {
+		return recordPatch{}, err
+	}
+	record, records, err := p.findRecord(mapNum, typ, state)
+	if err != nil {
+		return recordPatch{}, err
+	}
+
+	file, err := p.findMapFile(record.Sector())
+	if err != nil {
+		return recordPatch{}, err
+	}
+	capacity := sectorCount(file.size) * sectorSize
+	if int64(len(data)) > capacity {
+		return recordPatch{}, fmt.Errorf("%d bytes does not fit in %s, which has room for %d", len(data), file.name, capacity)
+	}
+
+	updated := map[int]GNSRecord{}
+	for i, r := range records {
+		if r.Sector() != file.sector {
+			continue
+		}
+		// Copy so the record that was found keeps its location.
+		r = append(GNSRecord{}, r...)
+		if err := r.SetLocation(file.sector, int64(len(data))); err != nil {
+			return recordPatch{}, err
+		}
+		updated[i] = r
+	}
+
+	// Zero the rest of the last sector so no stale data is left behind.
+	padded := make([]byte, capacity)
+	copy(padded, data)
+	return recordPatch{
+		record:    record,
+		file:      file,
+		data:      data,
+		padded:    padded,
+		gnsSector: gnsSec,
+		records:   updated,
+	}, nil
+}
+
+func (p DiscPatcher) write(patch recordPatch) error {
+	file := patch.file
+	if _, err := p.image.WriteAt(patch.padded, file.sector*sectorSize); err != nil {
+		return fmt.Errorf("write %s: %w", file.name, err)
+	}
+
+	// Directory records store the size both little and big endian.
+	var size [8]byte
+	binary.LittleEndian.PutUint32(size[0:4], uint32(len(patch.data)))
+	binary.BigEndian.PutUint32(size[4:8], uint32(len(patch.data)))
+	if _, err := p.image.WriteAt(size[:], file.recordOffset+10); err != nil {
+		return fmt.Errorf("write directory record of %s: %w", file.name, err)
+	}
+
+	for i, r := range patch.records {
+		if _, err := p.image.WriteAt(r, patch.gnsSector*sectorSize+int64(i*GNSRecordLen)); err != nil {
+			return fmt.Errorf("write gns record: %w", err)
+		}
+	}
+	return nil
+}
+
+// findRecord returns the map's record of the type for exactly the state, and
+// all of the map's records.
+func (p DiscPatcher) findRecord(mapNum int, typ RecordType, state MapState) (GNSRecord, []GNSRecord, error) {
+	records, err := NewMeshReader(p.iso).readGNSRecords(mapNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	record := findRecord(records, typ, state.normalize())
+	if record == nil {
+		return nil, nil, fmt.Errorf("map %d has no record of type %#x for %s", mapNum, int(typ), state.normalize())
+	}
+	return record, records, nil
+}
+
+// findMapFile returns the file in the MAP directory that starts at the sector.
+func (p DiscPatcher) findMapFile(sector int64) (isoFile, error) {
+	dir, err := findISOFile(p.image, mapDir)
+	if err != nil {
+		return isoFile{}, err
+	}
+	files, err := readDirectory(p.image, dir)
+	if err != nil {
+		return isoFile{}, err
+	}
+	for _, file := range files {
+		if !file.isDir && file.sector == sector {
+			return file, nil
+		}
+	}
+	return isoFile{}, fmt.Errorf("no file in %s starts at sector %d", mapDir, sector)
+}
@@ -0,0 +1,281 @@
+package fft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/adamrt/heretic"
+)
+
+func TestPatchMap(t *testing.T) {
+	for name, image := range testImages(t) {
+		t.Run(name, func(t *testing.T) {
+			patcher, err := NewDiscPatcher(image)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := testMap()
+			m.Mesh.Triangles = m.Mesh.Triangles[:2]
+			m.Mesh.Triangles[0].Points[1] = heretic.Vec3{X: 100, Y: -50, Z: 0}
+			m.Palettes[0][3] = heretic.PaletteColor{NRGBA: color.NRGBA{R: 248, G: 0, B: 8, A: 255}}
+			m.Mesh.Triangles[0].Palette = m.Palettes[0]
+			if err := patcher.PatchMap(testMapNum, DefaultMapState, m); err != nil {
+				t.Fatal(err)
+			}
+
+			r := NewMeshReader(patcher.Reader())
+			got, err := r.ReadMapRaw(testMapNum, DefaultMapState)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareMaps(t, got, m)
+
+			// The other state is untouched.
+			night, err := r.ReadMapRaw(testMapNum, testNight)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := len(testNightMap().Mesh.Triangles); len(night.Mesh.Triangles) != want {
+				t.Errorf("night has %d triangles, want %d", len(night.Mesh.Triangles), want)
+			}
+
+			// The directory record and GNS record have the new size.
+			mesh, err := EncodeMesh(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file, err := findISOFile(newDiscImage(image), "MAP/MAP001.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.size != int64(len(mesh)) {
+				t.Errorf("directory size = %d, want %d", file.size, len(mesh))
+			}
+			records, err := r.readGNSRecords(testMapNum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if records[0].Len() != int64(len(mesh)) {
+				t.Errorf("record length = %d, want %d", records[0].Len(), len(mesh))
+			}
+		})
+	}
+}
+
+func TestPatchBINSectors(t *testing.T) {
+	bin, err := testDisc(t).BIN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	patcher, err := NewDiscPatcher(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := patcher.findMapFile(DiscUS.GNSSectors[testMapNum] + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := patcher.PatchRecord(testMapNum, RecordTypeMeshPrimary, DefaultMapState, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	for sector := file.sector; sector < file.sector+sectorCount(file.size); sector++ {
+		raw := make([]byte, rawSectorSize)
+		if _, err := bin.ReadAt(raw, sector*rawSectorSize); err != nil {
+			t.Fatal(err)
+		}
+		check := make([]byte, rawSectorSize)
+		copy(check, raw)
+		sectorEDCECC(check)
+		if !bytes.Equal(check, raw) {
+			t.Fatalf("sector %d has stale EDC/ECC", sector)
+		}
+		if sector == file.sector && !bytes.Equal(raw[rawDataOffset:rawDataOffset+4], []byte{1, 2, 3, 0}) {
+			t.Errorf("sector %d data = % x", sector, raw[rawDataOffset:rawDataOffset+4])
+		}
+	}
+}
+
+func TestPatchTooBig(t *testing.T) {
+	image := testImages(t)["iso"]
+	patcher, err := NewDiscPatcher(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := NewMeshReader(patcher.Reader()).ReadMapRaw(testMapNum, DefaultMapState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mesh, err := EncodeMesh(testMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tooBig := make([]byte, sectorCount(int64(len(mesh)))*sectorSize+1)
+	if err := patcher.PatchRecord(testMapNum, RecordTypeMeshPrimary, DefaultMapState, tooBig); err == nil {
+		t.Fatal("expected an error for data that doesn't fit")
+	}
+
+	after, err := NewMeshReader(patcher.Reader()).ReadMapRaw(testMapNum, DefaultMapState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareMaps(t, after, before)
+}
+
+func TestPatchMapLostSections(t *testing.T) {
+	image := testImages(t)["iso"]
+	patcher, err := NewDiscPatcher(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := NewMeshReader(patcher.Reader()).ReadMapRaw(testMapNum, DefaultMapState)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Like a map that wasn't read from the disc, without the animations.
+	m := testMap()
+	m.unparsed = nil
+	if err := patcher.PatchMap(testMapNum, DefaultMapState, m); err == nil {
+		t.Fatal("expected an error for a mesh that loses sections")
+	}
+
+	after, err := NewMeshReader(patcher.Reader()).ReadMapRaw(testMapNum, DefaultMapState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareMaps(t, after, before)
+}
+
+func TestPatchRecordExactState(t *testing.T) {
+	patcher, err := NewDiscPatcher(testImages(t)["iso"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rain := MapState{Time: TimeDay, Weather: WeatherNormal}
+	if err := patcher.PatchRecord(testMapNum, RecordTypeMeshPrimary, rain, []byte{1}); err == nil {
+		t.Error("expected an error for a state without its own record")
+	}
+	// The alternate mesh isn't patched in place of the primary.
+	if err := patcher.PatchRecord(testAltMapNum, RecordTypeMeshPrimary, DefaultMapState, []byte{1}); err == nil {
+		t.Error("expected an error for a map without a primary mesh")
+	}
+	if err := patcher.PatchRecord(testAltMapNum, RecordTypeMeshAlt, DefaultMapState, []byte{1}); err != nil {
+		t.Error(err)
+	}
+}
+
+// primaryMesh returns the data of the map's primary mesh record for the state.
+func primaryMesh(t *testing.T, patcher DiscPatcher, mapNum int, state MapState) []byte {
+	t.Helper()
+	record, _, err := patcher.findRecord(mapNum, RecordTypeMeshPrimary, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := NewMeshReader(patcher.Reader()).readResource(mapNum, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// lossyMesh returns the test map's mesh with a light color above 1.0, which
+// a Map can't hold.
+func lossyMesh(t *testing.T) []byte {
+	t.Helper()
+	data, err := EncodeMesh(testMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptr := meshFileHeader(data).LightsAndBackground()
+	binary.LittleEndian.PutUint16(data[ptr:], 0x2000)
+	return data
+}
+
+func TestCheckReencodes(t *testing.T) {
+	// Meshes with the layout of the disc are written back byte for byte.
+	patcher, err := NewDiscPatcher(testImages(t)["iso"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := primaryMesh(t, patcher, testMapNum, DefaultMapState)
+	m, err := NewMeshReader(patcher.Reader()).ReadMapRaw(testMapNum, DefaultMapState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := EncodeMesh(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, data) {
+		t.Error("EncodeMesh(ReadMapRaw()) differs from the mesh on the disc")
+	}
+
+	for name, data := range map[string][]byte{"disc": data, "handmade": handmadeMesh()} {
+		if err := checkReencodes(data); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if err := checkReencodes(lossyMesh(t)); err == nil || !strings.Contains(err.Error(), "lights") {
+		t.Errorf("checkReencodes() = %v, want an error for the lights", err)
+	}
+}
+
+func TestPatchMapLossyMesh(t *testing.T) {
+	patcher, err := NewDiscPatcher(testImages(t)["iso"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	lossy := lossyMesh(t)
+	if err := patcher.PatchRecord(testMapNum, RecordTypeMeshPrimary, DefaultMapState, lossy); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := patcher.PatchMap(testMapNum, DefaultMapState, testMap()); err == nil {
+		t.Error("PatchMap succeeded over a mesh it can't write back")
+	}
+	mesh, err := EncodeMesh(testMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := patcher.PatchMesh(testMapNum, DefaultMapState, mesh); err == nil {
+		t.Error("PatchMesh succeeded over a mesh it can't write back")
+	}
+	if got := primaryMesh(t, patcher, testMapNum, DefaultMapState); !bytes.Equal(got, lossy) {
+		t.Error("the mesh was written")
+	}
+}
+
+func TestPatchMapTextureTooBig(t *testing.T) {
+	// The texture file on the disc is too small for any texture.
+	disc := newFixtureDisc()
+	m := testMap()
+	m.Mesh.Texture = nil
+	if err := disc.AddMap(testMapNum, DefaultMapState, m); err != nil {
+		t.Fatal(err)
+	}
+	disc.AddResource(testMapNum, RecordTypeTexture, DefaultMapState, []byte{1})
+	image, err := disc.ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	patcher, err := NewDiscPatcher(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := primaryMesh(t, patcher, testMapNum, DefaultMapState)
+
+	edited := testMap()
+	edited.Mesh.Triangles = edited.Mesh.Triangles[:2]
+	if err := patcher.PatchMap(testMapNum, DefaultMapState, edited); err == nil {
+		t.Fatal("expected an error for a texture that doesn't fit")
+	}
+	if after := primaryMesh(t, patcher, testMapNum, DefaultMapState); !bytes.Equal(after, before) {
+		t.Error("the mesh was written before the texture was found not to fit")
+	}
+}
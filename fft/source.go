@@ -0,0 +1,247 @@
+// This file contains the places map data can be read from.
+//
+// A map is a GNS file, which lists the records of the map, and a number of
+// resource files (textures, mesh data, etc) that the records point to. On the
+// disc, records point to resources by sector. The ISO source reads the sectors
+// directly. The directory source reads files extracted from the disc's MAP
+// directory and works out which file each record points to.
+package fft
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MapSource provides the raw files of maps.
+type MapSource interface {
+	// GNS returns the contents of the map's GNS file.
+	GNS(mapNum int) (io.ReaderAt, error)
+
+	// Resource returns the contents of the file the record points to.
+	// Intra-file pointers are offsets into it.
+	Resource(mapNum int, record GNSRecord) (io.ReaderAt, error)
+
+	// Version is the release of the game the maps are from.
+	Version() *DiscVersion
+}
+
+// gnsMaxLen is the most we read of a GNS file from the ISO, where the length
+// isn't known. GNS files are a handful of 20 byte records so this is plenty.
+const gnsMaxLen = 4 * sectorSize
+
+func (r ISOReader) GNS(mapNum int) (io.ReaderAt, error) {
+	sector, err := gnsSector(r.Version(), mapNum)
+	if err != nil {
+		return nil, err
+	}
+	return r.section(sector, gnsMaxLen), nil
+}
+
+func (r ISOReader) Resource(mapNum int, record GNSRecord) (io.ReaderAt, error) {
+	return r.section(record.Sector(), record.Len()), nil
+}
+
+func (r ISOReader) Version() *DiscVersion {
+	return r.info.Version
+}
+
+// gnsSector returns the sector of the map's GNS file.
+func gnsSector(version *DiscVersion, mapNum int) (int64, error) {
+	if mapNum < 0 || mapNum >= len(version.GNSSectors) || version.GNSSectors[mapNum] == 0 {
+		return 0, fmt.Errorf("map %d does not exist", mapNum)
+	}
+	return version.GNSSectors[mapNum], nil
+}
+
+// NewDirSource returns a MapSource that reads files extracted from the MAP
+// directory of the disc (MAP000.GNS, MAP000.5, MAP000.8, etc). The version is
+// the release the files were extracted from.
+//
+// The directory is read once, and the sector of every file is worked out up
+// front. An error is returned if a map's records don't point to the start of
+// one of its files with the record's length, since then the files can't be
+// laid out like they are on the disc.
+func NewDirSource(dir string, version *DiscVersion) (DirSource, error) {
+	s := DirSource{dir: dir, version: version, maps: map[int]dirMap{}}
+
+	files, err := readMapDir(dir)
+	if err != nil {
+		return DirSource{}, err
+	}
+	for mapNum, files := range files {
+		if files.gns == "" {
+			continue
+		}
+		m, err := layoutMap(version, mapNum, files)
+		if err != nil {
+			return DirSource{}, fmt.Errorf("%s: %w", dir, err)
+		}
+		s.maps[mapNum] = m
+	}
+	return s, nil
+}
+
+// DirSource reads maps from a directory of extracted files.
+//
+// Records point to resources by sector, which extracted files don't have. On
+// the disc, a map's resource files are stored right after its GNS file in the
+// order of their numeric extensions. So the sector of each file can be worked
+// out from the version's GNS sectors and the file sizes. The file that starts
+// at the record's sector, and has the record's length, is the resource.
+type DirSource struct {
+	dir     string
+	version *DiscVersion
+	maps    map[int]dirMap
+}
+
+// dirMap is the files of a map, with resources by the sector they would be at
+// on the disc.
+type dirMap struct {
+	gns     string
+	sectors map[int64]mapFile
+}
+
+func (s DirSource) GNS(mapNum int) (io.ReaderAt, error) {
+	m, ok := s.maps[mapNum]
+	if !ok {
+		return nil, fmt.Errorf("map %d does not exist in %s", mapNum, s.dir)
+	}
+	return readFile(m.gns)
+}
+
+func (s DirSource) Resource(mapNum int, record GNSRecord) (io.ReaderAt, error) {
+	m, ok := s.maps[mapNum]
+	if !ok {
+		return nil, fmt.Errorf("map %d does not exist in %s", mapNum, s.dir)
+	}
+	f, err := m.resource(record)
+	if err != nil {
+		return nil, fmt.Errorf("%s: map %d: %w", s.dir, mapNum, err)
+	}
+	return readFile(f.path)
+}
+
+func (s DirSource) Version() *DiscVersion {
+	return s.version
+}
+
+// resource returns the file the record points to.
+func (m dirMap) resource(record GNSRecord) (mapFile, error) {
+	f, ok := m.sectors[record.Sector()]
+	if !ok {
+		return mapFile{}, fmt.Errorf("no file at sector %d", record.Sector())
+	}
+	if f.size != record.Len() {
+		return mapFile{}, fmt.Errorf("%s is %d bytes, record expects %d", f.path, f.size, record.Len())
+	}
+	return f, nil
+}
+
+type mapFile struct {
+	path string
+	size int64
+	ext  int
+}
+
+type mapFiles struct {
+	gns       string
+	gnsSize   int64
+	resources []mapFile // Sorted by extension
+}
+
+// layoutMap works out the sector of each of the map's files and checks that
+// every record of its GNS file points to one of them.
+func layoutMap(version *DiscVersion, mapNum int, files mapFiles) (dirMap, error) {
+	sector, err := gnsSector(version, mapNum)
+	if err != nil {
+		return dirMap{}, err
+	}
+
+	m := dirMap{gns: files.gns, sectors: map[int64]mapFile{}}
+	sector += sectorCount(files.gnsSize)
+	for _, f := range files.resources {
+		m.sectors[sector] = f
+		sector += sectorCount(f.size)
+	}
+
+	data, err := os.ReadFile(files.gns)
+	if err != nil {
+		return dirMap{}, err
+	}
+	records, err := ParseGNS(data)
+	if err != nil {
+		return dirMap{}, fmt.Errorf("map %d: %w", mapNum, err)
+	}
+	for _, record := range records {
+		if _, err := m.resource(record); err != nil {
+			return dirMap{}, fmt.Errorf("map %d: %w", mapNum, err)
+		}
+	}
+	return m, nil
+}
+
+// readMapDir finds the GNS and resource files of every map in the directory.
+// Names are matched case insensitively since extraction tools don't agree on
+// case.
+func readMapDir(dir string) (map[int]mapFiles, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	maps := map[int]mapFiles{}
+	for _, entry := range entries {
+		// MAP000.GNS, MAP000.5, etc.
+		name := strings.ToUpper(entry.Name())
+		if entry.IsDir() || len(name) < len("MAP000.") || !strings.HasPrefix(name, "MAP") || name[6] != '.' {
+			continue
+		}
+		mapNum, err := strconv.Atoi(name[3:6])
+		if err != nil {
+			continue
+		}
+		ext := name[7:]
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		files := maps[mapNum]
+		if ext == "GNS" {
+			files.gns = path
+			files.gnsSize = info.Size()
+		} else if n, err := strconv.Atoi(ext); err == nil {
+			files.resources = append(files.resources, mapFile{path: path, size: info.Size(), ext: n})
+		} else {
+			continue
+		}
+		maps[mapNum] = files
+	}
+
+	for _, files := range maps {
+		sort.Slice(files.resources, func(i, j int) bool {
+			return files.resources[i].ext < files.resources[j].ext
+		})
+	}
+	return maps, nil
+}
+
+// sectorCount returns the number of sectors a file of size bytes takes up.
+func sectorCount(size int64) int64 {
+	return (size + sectorSize - 1) / sectorSize
+}
+
+func readFile(path string) (io.ReaderAt, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
@@ -0,0 +1,79 @@
+package fft
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeMapFiles writes the fixture disc's map files to a directory, changing
+// them with edit first.
+func writeMapFiles(t *testing.T, edit func(name string, data []byte) []byte) string {
+	t.Helper()
+	files, err := testDisc(t).MapFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, data := range files {
+		data = edit(name, data)
+		if data == nil {
+			continue
+		}
+		// Extraction tools don't agree on case.
+		if err := os.WriteFile(filepath.Join(dir, strings.ToLower(name)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDirSource(t *testing.T) {
+	dir := writeMapFiles(t, func(name string, data []byte) []byte { return data })
+	source, err := NewDirSource(dir, DiscUS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewMeshReader(source)
+	for _, state := range []MapState{DefaultMapState, testNight} {
+		got, err := r.ReadMapRaw(testMapNum, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := testReader(t, testImages(t)["iso"]).ReadMapRaw(testMapNum, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareMaps(t, got, want)
+	}
+	if _, err := source.GNS(testMapNum + 10); err == nil {
+		t.Error("expected an error for a map that isn't in the directory")
+	}
+}
+
+func TestDirSourceWrongSize(t *testing.T) {
+	dir := writeMapFiles(t, func(name string, data []byte) []byte {
+		if name == "MAP001.1" {
+			return data[:len(data)-1]
+		}
+		return data
+	})
+	if _, err := NewDirSource(dir, DiscUS); err == nil {
+		t.Error("expected an error for a file that doesn't match its record")
+	}
+}
+
+func TestDirSourceMissingFile(t *testing.T) {
+	// Without the first resource, the sectors of the rest are all wrong.
+	dir := writeMapFiles(t, func(name string, data []byte) []byte {
+		if name == "MAP001.1" {
+			return nil
+		}
+		return data
+	})
+	if _, err := NewDirSource(dir, DiscUS); err == nil {
+		t.Error("expected an error for files that aren't contiguous")
+	}
+}
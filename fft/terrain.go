@@ -0,0 +1,139 @@
+// This file contains the ability to parse map terrain.
+//
+// Terrain is the gameplay representation of a map. It is a grid of tiles, each
+// with a height, slope and surface type. It is separate from the mesh, which
+// is only for rendering. A map can have two levels of tiles, the second level
+// is used for things like bridges and rooftops.
+package fft
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	terrainLevels   = 2
+	terrainMaxTiles = 256
+	terrainTileLen  = 8
+
+	// terrainLen is the length in bytes of the header and all tiles.
+	terrainLen = 2 + terrainLevels*terrainMaxTiles*terrainTileLen
+)
+
+// Terrain is the tile grid of a map. Tiles are stored row by row, Width tiles
+// per row, for Depth rows.
+type Terrain struct {
+	Width int // Number of tiles along the X axis
+	Depth int // Number of tiles along the Z axis
+
+	Levels [terrainLevels][]Tile
+
+	// raw is the terrain section the terrain was read from. The bits of
+	// each tile that aren't fields of Tile, like the camera and shading
+	// flags, and the unused tiles are written back from it.
+	raw []byte
+}
+
+// Tile returns the tile at the x/z position of the specified level.
+func (t Terrain) Tile(level, x, z int) Tile {
+	return t.Levels[level][z*t.Width+x]
+}
+
+// Tile is a single terrain tile. Heights are in FFT height units (h), which is
+// what the game displays to the player.
+type Tile struct {
+	SurfaceType  int
+	Height       int
+	Depth        int
+	SlopeHeight  int
+	SlopeType    int
+	Impassable   bool
+	Unselectable bool
+}
+
+func (r *dataReader) readTile() Tile {
+	surface := r.readUint8()
+	r.readUint8() // unknown
+	height := r.readUint8()
+	depthSlope := r.readUint8()
+	slopeType := r.readUint8()
+	r.readUint8() // unknown
+	flags := r.readUint8()
+	r.readUint8() // camera/shading flags
+
+	return Tile{
+		SurfaceType:  int(surface & 0b0011_1111),
+		Height:       int(height),
+		Depth:        int(depthSlope >> 5),
+		SlopeHeight:  int(depthSlope & 0b0001_1111),
+		SlopeType:    int(slopeType),
+		Impassable:   flags&0b0000_0010 != 0,
+		Unselectable: flags&0b0000_0001 != 0,
+	}
+}
+
+// put writes the fields of the tile over the 8 bytes of a tile. The bits
+// that aren't fields of Tile are left as they are.
+func (t Tile) put(b []byte) {
+	var flags uint8
+	if t.Impassable {
+		flags |= 0b0000_0010
+	}
+	if t.Unselectable {
+		flags |= 0b0000_0001
+	}
+	b[0] = b[0]&0b1100_0000 | uint8(t.SurfaceType&0b0011_1111)
+	b[2] = uint8(t.Height)
+	b[3] = uint8(t.Depth<<5 | t.SlopeHeight&0b0001_1111)
+	b[4] = uint8(t.SlopeType)
+	b[6] = b[6]&^0b0000_0011 | flags
+}
+
+// readTerrain reads the terrain header and both levels of tiles. The data
+// always has room for 256 tiles per level, but only Width*Depth are used. A
+// size with more than 256 tiles is an error.
+func (r *dataReader) readTerrain() Terrain {
+	raw := r.readBytes(terrainLen)
+	if r.err != nil {
+		return Terrain{}
+	}
+	tr := newDataReader(bytes.NewReader(raw), 0)
+	width := int(tr.readUint8())
+	depth := int(tr.readUint8())
+	if width*depth > terrainMaxTiles {
+		r.err = fmt.Errorf("terrain is %dx%d, more than %d tiles", width, depth, terrainMaxTiles)
+		return Terrain{}
+	}
+
+	terrain := Terrain{Width: width, Depth: depth, raw: raw}
+	for level := 0; level < terrainLevels; level++ {
+		tiles := make([]Tile, 0, width*depth)
+		for i := 0; i < terrainMaxTiles; i++ {
+			tile := tr.readTile()
+			if i < width*depth {
+				tiles = append(tiles, tile)
+			}
+		}
+		terrain.Levels[level] = tiles
+	}
+	return terrain
+}
+
+// encode returns the terrain section. Without a section it was read from,
+// the bits that aren't fields of Tile and the unused tiles are zero.
+func (t Terrain) encode() []byte {
+	data := make([]byte, terrainLen)
+	copy(data, t.raw)
+	data[0] = uint8(t.Width)
+	data[1] = uint8(t.Depth)
+	for level := 0; level < terrainLevels; level++ {
+		for i, tile := range t.Levels[level] {
+			if i == terrainMaxTiles {
+				break
+			}
+			off := 2 + (level*terrainMaxTiles+i)*terrainTileLen
+			tile.put(data[off : off+terrainTileLen])
+		}
+	}
+	return data
+}
@@ -0,0 +1,37 @@
+package fft
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestTerrainRoundTrip reads terrain with every bit of every tile set, like
+// the unknown bytes and camera flags of retail maps, and writes it back.
+func TestTerrainRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte{0xFF}, terrainLen)
+	data[0], data[1] = 2, 1
+
+	r := newDataReader(bytes.NewReader(data), 0)
+	terrain := r.readTerrain()
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	want := Tile{SurfaceType: 63, Height: 255, Depth: 7, SlopeHeight: 31, SlopeType: 255, Impassable: true, Unselectable: true}
+	if got := terrain.Tile(1, 1, 0); got != want {
+		t.Errorf("tile = %+v, want %+v", got, want)
+	}
+	if got := terrain.encode(); !bytes.Equal(got, data) {
+		t.Error("terrain changed when written back")
+	}
+
+	// Editing a tile only changes its fields.
+	terrain.Levels[0][1].Height = 3
+	terrain.Levels[0][1].Impassable = false
+	got := terrain.encode()
+	off := 2 + terrainTileLen
+	data[off+2] = 3
+	data[off+6] = 0b1111_1101
+	if !bytes.Equal(got, data) {
+		t.Errorf("edited tile = % x, want % x", got[off:off+terrainTileLen], data[off:off+terrainTileLen])
+	}
+}
@@ -1,6 +1,10 @@
 package fft
 
-import "image/color"
+import (
+	"image"
+
+	"github.com/adamrt/heretic"
+)
 
 const (
 	textureWidth  int = 256
@@ -9,21 +13,42 @@ const (
 	textureRawLen int = textureLen / 2
 )
 
-// textureSplitPixels takes the ISO's raw bytes and splits each of them into two
-// bytes. The ISO has two pixels per byte to save space. We want each pixel
-// independent, so we split them here.
-func textureSplitPixels(buf []byte) []color.NRGBA {
-	data := make([]color.NRGBA, 0)
-	for i := 0; i < textureRawLen; i++ {
-		colorA := uint8(buf[i] & 0x0F)
-		colorB := uint8((buf[i] & 0xF0) >> 4)
+// TextureImage renders a texture read by ReadMap through the palette. The
+// texture only has palette indexes, this turns them into the colors the game
+// would draw. Indexes whose color is transparent are transparent.
+func TextureImage(t heretic.IndexedTexture, palette heretic.Palette) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, t.Width(), t.Height()))
+	drawTexture(img, image.Point{}, t, palette)
+	return img
+}
+
+// TextureSheet renders the texture through every palette into a single image.
+// Each set of palettes, such as the color and gray palettes of a map, is a
+// row and each palette in it is a column.
+func TextureSheet(t heretic.IndexedTexture, sets ...[]heretic.Palette) *image.NRGBA {
+	cols := 0
+	for _, set := range sets {
+		if len(set) > cols {
+			cols = len(set)
+		}
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, cols*t.Width(), len(sets)*t.Height()))
+	for row, set := range sets {
+		for col, palette := range set {
+			drawTexture(img, image.Pt(col*t.Width(), row*t.Height()), t, palette)
+		}
+	}
+	return img
+}
 
-		// We dont care about RGB here.
-		// This is just an index to the palette.
-		data = append(data,
-			color.NRGBA{R: colorA, G: colorA, B: colorA, A: 255},
-			color.NRGBA{R: colorB, G: colorB, B: colorB, A: 255},
-		)
+// drawTexture draws the texture through the palette with its top left corner
+// at the point.
+func drawTexture(img *image.NRGBA, at image.Point, t heretic.IndexedTexture, palette heretic.Palette) {
+	for y := 0; y < t.Height(); y++ {
+		for x := 0; x < t.Width(); x++ {
+			if c, ok := t.Sample(x, y, palette); ok {
+				img.SetNRGBA(at.X+x, at.Y+y, c.NRGBA)
+			}
+		}
 	}
-	return data
 }
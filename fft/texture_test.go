@@ -0,0 +1,84 @@
+package fft
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/adamrt/heretic"
+)
+
+func TestParseTexture(t *testing.T) {
+	want, _ := testMap().Texture()
+	data, err := EncodeTexture(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseTexture(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("texture differs after encoding")
+	}
+
+	if _, err := ParseTexture(data[:len(data)-1]); err == nil {
+		t.Error("expected an error for a short texture")
+	}
+}
+
+func TestTextureSample(t *testing.T) {
+	m := testMap()
+	texture, _ := m.Texture()
+	if idx := texture.Index(0, 0); idx != 0 {
+		t.Errorf("index 0 = %d", idx)
+	}
+	if idx := texture.Index(textureWidth+15, 0); idx != 15 {
+		t.Errorf("index %d = %d, want 15", textureWidth+15, idx)
+	}
+
+	// Index 0 is transparent in every palette.
+	if _, ok := texture.Sample(0, 0, m.Palettes[1]); ok {
+		t.Error("index 0 should be transparent")
+	}
+	c, ok := texture.Sample(5, 0, m.Palettes[1])
+	if !ok || c != m.Palettes[1][5] {
+		t.Errorf("sample = %v, %v, want %v", c, ok, m.Palettes[1][5])
+	}
+	// Without a palette there is nothing to draw.
+	if _, ok := texture.Sample(5, 0, nil); ok {
+		t.Error("sample without a palette should be transparent")
+	}
+	// The texture's own CLUT is used when the sample has none.
+	withCLUT := heretic.NewIndexedTexture(texture.Width(), texture.Height(), 4, texture.Pix(), m.GrayPalettes[0])
+	if c, ok := withCLUT.Sample(5, 0, nil); !ok || c != m.GrayPalettes[0][5] {
+		t.Errorf("sample with CLUT = %v, %v, want %v", c, ok, m.GrayPalettes[0][5])
+	}
+
+	if _, err := EncodeTexture(heretic.NewIndexedTexture(textureWidth, textureHeight, 8, make([]byte, textureLen), nil)); err == nil {
+		t.Error("expected an error encoding an 8bpp texture")
+	}
+}
+
+func TestTextureSheet(t *testing.T) {
+	m := testMap()
+	texture, _ := m.Texture()
+	img := TextureImage(texture, m.Palettes[3])
+	if b := img.Bounds(); b.Dx() != textureWidth || b.Dy() != textureHeight {
+		t.Fatalf("bounds = %v", b)
+	}
+	// Index 0 is transparent, index 1 is the palette's first color.
+	if c := img.NRGBAAt(0, 0); c.A != 0 {
+		t.Errorf("pixel 0 = %v, want transparent", c)
+	}
+	if c := img.NRGBAAt(1, 0); c != m.Palettes[3][1].NRGBA {
+		t.Errorf("pixel 1 = %v, want %v", c, m.Palettes[3][1].NRGBA)
+	}
+
+	sheet := TextureSheet(texture, m.Palettes, m.GrayPalettes)
+	if b := sheet.Bounds(); b.Dx() != 16*textureWidth || b.Dy() != 2*textureHeight {
+		t.Fatalf("sheet bounds = %v", b)
+	}
+	if c := sheet.NRGBAAt(2*textureWidth+1, textureHeight); c != m.GrayPalettes[2][1].NRGBA {
+		t.Errorf("gray palette 2 pixel 1 = %v, want %v", c, m.GrayPalettes[2][1].NRGBA)
+	}
+}
@@ -0,0 +1,171 @@
+// This file contains a way to write binary data in the format of the FFT ISO.
+//
+// It is the counterpart of the low level read methods in iso.go. Every write
+// method produces bytes that the matching read method turns back into the same
+// value. The higher level encoding happens in encode.go.
+package fft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"math"
+
+	"github.com/adamrt/heretic"
+)
+
+// dataWriter writes sequential little-endian data to a buffer.
+type dataWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *dataWriter) Len() int64          { return int64(w.buf.Len()) }
+func (w *dataWriter) Bytes() []byte       { return w.buf.Bytes() }
+func (w *dataWriter) writeBytes(b []byte) { w.buf.Write(b) }
+
+// pad writes zeros until the buffer is a multiple of n bytes long.
+func (w *dataWriter) pad(n int64) {
+	for w.Len()%n != 0 {
+		w.writeUint8(0)
+	}
+}
+
+func (w *dataWriter) writeUint8(v uint8) {
+	w.buf.WriteByte(v)
+}
+
+func (w *dataWriter) writeUint16(v uint16) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *dataWriter) writeUint32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *dataWriter) writeInt16(v int16) { w.writeUint16(uint16(v)) }
+
+func (w *dataWriter) writeRGB8(c color.NRGBA) {
+	w.writeUint8(c.R)
+	w.writeUint8(c.G)
+	w.writeUint8(c.B)
+}
+
+// writeRGB15 writes a PlayStation 15-bit color. Fully transparent colors are
+// written as 0x0000, which is the only value readRGB15 treats as transparent.
+func (w *dataWriter) writeRGB15(c heretic.PaletteColor) {
+	if c.A == 0 {
+		w.writeUint16(0)
+		return
+	}
+	val := uint16(c.R>>3) | uint16(c.G>>3)<<5 | uint16(c.B>>3)<<10
+	if c.STP {
+		val |= 0b10000000_00000000
+	}
+	w.writeUint16(val)
+}
+
+func (w *dataWriter) writeVertex(v heretic.Vec3) {
+	w.writeInt16(int16(math.Round(v.X)))
+	w.writeInt16(int16(math.Round(-v.Y)))
+	w.writeInt16(int16(math.Round(v.Z)))
+}
+
+func (w *dataWriter) writeF1x3x12(v float64) {
+	v = math.Max(-8, math.Min(v, 32767.0/4096.0))
+	w.writeInt16(int16(math.Round(v * 4096.0)))
+}
+
+func (w *dataWriter) writeNormal(n heretic.Vec3) {
+	w.writeF1x3x12(n.X)
+	w.writeF1x3x12(-n.Y)
+	w.writeF1x3x12(n.Z)
+}
+
+// writeUV writes a normalized texture coordinate back into the 0-255 U and the
+// V of its page. See processTexCoords().
+func (w *dataWriter) writeUV(uv heretic.Tex) {
+	u, v, _ := unprocessTexCoords(uv)
+	w.writeUint8(u)
+	w.writeUint8(v)
+}
+
+// writeTriUV writes the texture data of a triangle. The page is taken from the
+// first texture coordinate, all three are on the same page. The rest of the
+// attribute bits come from the polygon the triangle was read from.
+func (w *dataWriter) writeTriUV(texCoords []heretic.Tex, palette int, blendMode heretic.BlendMode, src Polygon) {
+	_, _, page := unprocessTexCoords(texCoords[0])
+	w.writeUV(texCoords[0])
+	w.writeUint16(src.CLUT&^0b1111 | uint16(palette&0b1111))
+	w.writeUV(texCoords[1])
+	w.writeUint16(blendModeTexpage(src.Texpage&^0b11|uint16(page&0b11), blendMode))
+	w.writeUV(texCoords[2])
+}
+
+// writeQuadUV is writeTriUV with the fourth texture coordinate of a quad.
+func (w *dataWriter) writeQuadUV(texCoords []heretic.Tex, palette int, blendMode heretic.BlendMode, src Polygon) {
+	w.writeTriUV(texCoords, palette, blendMode, src)
+	w.writeUV(texCoords[3])
+}
+
+// blendModeTexpage is the inverse of texpageBlendMode. It sets the blending
+// bits of the texpage attribute. Opaque polygons keep the mode bits they
+// had, only the semi-transparency flag is cleared.
+func blendModeTexpage(texpage uint16, mode heretic.BlendMode) uint16 {
+	if mode == heretic.BlendModeOpaque {
+		return texpage &^ texpageSemiTransparent
+	}
+	texpage &^= 0b11 << 5
+	return texpage | texpageSemiTransparent | uint16(mode-heretic.BlendModeAverage)<<5
+}
+
+func (w *dataWriter) writeUntexturedData(c color.NRGBA, code uint8) {
+	w.writeRGB8(c)
+	w.writeUint8(code)
+}
+
+func (w *dataWriter) writeTileLocation(loc *heretic.TileLocation) {
+	if loc == nil {
+		w.writeUint16(noTileLocation)
+		return
+	}
+	w.writeUint8(uint8(loc.Z<<1 | loc.Level&0b1))
+	w.writeUint8(uint8(loc.X))
+}
+
+// writeLightColor writes a 0-255 color component as a 0.0-1.0 fixed point
+// value. It rounds up so readLightColor, which truncates, gets the same value.
+func (w *dataWriter) writeLightColor(c uint8) {
+	w.writeInt16(int16(math.Ceil(float64(c) * 4096.0 / 255.0)))
+}
+
+func (w *dataWriter) writeDirectionalLights(lights []heretic.DirectionalLight) {
+	// There are always three lights. Missing lights are written black.
+	var l [3]heretic.DirectionalLight
+	copy(l[:], lights)
+
+	w.writeLightColor(l[0].Color.R)
+	w.writeLightColor(l[1].Color.R)
+	w.writeLightColor(l[2].Color.R)
+	w.writeLightColor(l[0].Color.G)
+	w.writeLightColor(l[1].Color.G)
+	w.writeLightColor(l[2].Color.G)
+	w.writeLightColor(l[0].Color.B)
+	w.writeLightColor(l[1].Color.B)
+	w.writeLightColor(l[2].Color.B)
+
+	w.writeVertex(l[0].Position)
+	w.writeVertex(l[1].Position)
+	w.writeVertex(l[2].Position)
+}
+
+// unprocessTexCoords is the inverse of processTexCoords. It returns the U and
+// V on the page and the page.
+func unprocessTexCoords(uv heretic.Tex) (uint8, uint8, int) {
+	u := int(math.Round(uv.U * 255))
+	v := int(math.Round(uv.V * 1023))
+	return uint8(u), uint8(v % 256), v / 256
+}
@@ -1,6 +1,7 @@
 package heretic
 
 import (
+	"image"
 	"image/color"
 	"math"
 )
@@ -20,6 +21,15 @@ type Framebuffer struct {
 	color         []color.NRGBA
 }
 
+// Image returns a copy of the colors in the buffer.
+func (fb *Framebuffer) Image() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, fb.width, fb.height))
+	for i, c := range fb.color {
+		copy(img.Pix[i*4:], []uint8{c.R, c.G, c.B, c.A})
+	}
+	return img
+}
+
 // Clear writes over every color in the buffer
 func (fb *Framebuffer) Clear(color color.NRGBA) {
 	for x := 0; x < fb.width; x++ {
@@ -58,6 +68,15 @@ func (fb *Framebuffer) DrawPixel(x, y int, color color.NRGBA) {
 	}
 }
 
+// blendPixel blends a color with the pixel already at the specified
+// coordinates.
+func (fb *Framebuffer) blendPixel(x, y int, color color.NRGBA, mode BlendMode) {
+	if x > 0 && x < int(fb.width) && y > 0 && y < int(fb.height) {
+		i := (fb.width * y) + x
+		fb.color[i] = blend(fb.color[i], color, mode)
+	}
+}
+
 func (fb *Framebuffer) DrawBackground(background Background) {
 	for y := 0; y < fb.height; y++ {
 		color := background.At(y, fb.height)
@@ -68,7 +87,7 @@ func (fb *Framebuffer) DrawBackground(background Background) {
 }
 
 // DrawTexel draws a single textured pixels at the specified coordinates.
-func (fb *Framebuffer) DrawTexel(x, y int, a, b, c Vec4, auv, buv, cuv Tex, lightIntensity float64, palette Palette, texture Texture) {
+func (fb *Framebuffer) DrawTexel(x, y int, a, b, c Vec4, auv, buv, cuv Tex, lightIntensity float64, palette Palette, blendMode BlendMode, texture Sampler) {
 	pointP := Vec2{float64(x), float64(y)}
 
 	weights := barycentricWeights(a.Vec2(), b.Vec2(), c.Vec2(), pointP)
@@ -89,57 +108,59 @@ func (fb *Framebuffer) DrawTexel(x, y int, a, b, c Vec4, auv, buv, cuv Tex, ligh
 	interpolatedU /= interpolatedReciprocalW
 	interpolatedV /= interpolatedReciprocalW
 
-	textureX := int(math.Abs(interpolatedU*float64(texture.width))) % texture.width
-	textureY := int(math.Abs(interpolatedV*float64(texture.height))) % texture.height
+	textureX := int(math.Abs(interpolatedU*float64(texture.Width()))) % texture.Width()
+	textureY := int(math.Abs(interpolatedV*float64(texture.Height()))) % texture.Height()
 
-	// Adjust 1/w so the pixels that are closer to the cam have smaller values
-	interpolatedReciprocalW = 1.0 - interpolatedReciprocalW
+	depth := interpolateDepth(a, b, c, weights)
 
 	// Only draw pixel if depth value is less than one previously stored in zbuffer.
-	if interpolatedReciprocalW < fb.Depth(x, y) {
-		textureColor := texture.data[(textureY*texture.width)+textureX]
-		// If there is a palette, the current color components will
-		// represent the index into the palette.
-		if palette != nil {
-			textureColor = palette[textureColor.R]
+	if depth < fb.Depth(x, y) {
+		texel, ok := texture.Sample(textureX, textureY, palette)
+		if !ok {
+			return
 		}
 
-		textureColorWithLight := textureColor
+		textureColorWithLight := texel.NRGBA
 		// Disabling this until we get proper lighting
 		// textureWithLightColor := applyLightIntensity(textureColor, lightIntensity)
 
-		// This handels transparent colors when there is a palette (FFT).
-		if isTransparent(textureColor) && palette != nil {
+		// Semi-transparent texels are blended and don't write depth so
+		// anything drawn behind them later still shows through.
+		if texel.STP && blendMode != BlendModeOpaque {
+			fb.blendPixel(x, y, textureColorWithLight, blendMode)
 			return
 		}
 		fb.DrawPixel(x, y, textureColorWithLight)
-		fb.SetDepth(x, y, interpolatedReciprocalW)
+		fb.SetDepth(x, y, depth)
 	}
 }
 
-func (fb *Framebuffer) DrawTrianglePixel(x, y int, a, b, c Vec4, color color.NRGBA) {
+func (fb *Framebuffer) DrawTrianglePixel(x, y int, a, b, c Vec4, color color.NRGBA, blendMode BlendMode) {
 	pointP := Vec2{float64(x), float64(y)}
 
 	weights := barycentricWeights(a.Vec2(), b.Vec2(), c.Vec2(), pointP)
 
-	alpha := weights.X
-	beta := weights.Y
-	gamma := weights.Z
-
-	// FIXME: move this calculation out of the function as it only needs to
-	// be calcualted once per triangle.
-	interpolatedReciprocalW := (1/a.W)*alpha + (1/b.W)*beta + (1/c.W)*gamma
-
-	// Adjust 1/w so the pixels that are closer to the cam have smaller values
-	interpolatedReciprocalW = 1.0 - interpolatedReciprocalW
+	depth := interpolateDepth(a, b, c, weights)
 
 	// Only draw pixel if depth value is less than one previously stored in zbuffer.
-	if interpolatedReciprocalW < fb.Depth(x, y) {
+	if depth < fb.Depth(x, y) {
+		if blendMode != BlendModeOpaque {
+			fb.blendPixel(x, y, color, blendMode)
+			return
+		}
 		fb.DrawPixel(x, y, color)
-		fb.SetDepth(x, y, interpolatedReciprocalW)
+		fb.SetDepth(x, y, depth)
 	}
 }
 
+// interpolateDepth returns the depth of the pixel with the barycentric
+// weights. Z is the 0-1 depth after the perspective divide, which is linear
+// in screen space for both perspective and orthographic projections, unlike
+// 1/w which is constant for orthographic projections.
+func interpolateDepth(a, b, c Vec4, weights Vec3) float64 {
+	return a.Z*weights.X + b.Z*weights.Y + c.Z*weights.Z
+}
+
 // DrawLine draws a solid line using the DDA algorithm.
 func (fb *Framebuffer) DrawLine(x0, y0, x1, y1 int, color color.NRGBA) {
 	deltaX := x1 - x0
@@ -276,7 +297,7 @@ func (fb *Framebuffer) DrawFilledTriangle(tri Triangle, color color.NRGBA) {
 			}
 
 			for x := xStart; x < xEnd; x++ {
-				fb.DrawTrianglePixel(x, y, a, b, c, color)
+				fb.DrawTrianglePixel(x, y, a, b, c, color, tri.BlendMode)
 			}
 		}
 	}
@@ -304,13 +325,13 @@ func (fb *Framebuffer) DrawFilledTriangle(tri Triangle, color color.NRGBA) {
 			}
 
 			for x := xStart; x < xEnd; x++ {
-				fb.DrawTrianglePixel(x, y, a, b, c, color)
+				fb.DrawTrianglePixel(x, y, a, b, c, color, tri.BlendMode)
 			}
 		}
 	}
 }
 
-func (fb *Framebuffer) DrawTexturedTriangle(tri Triangle, texture Texture) {
+func (fb *Framebuffer) DrawTexturedTriangle(tri Triangle, texture Sampler) {
 	ta := tri.Projected[0]
 	tb := tri.Projected[1]
 	tc := tri.Projected[2]
@@ -378,7 +399,7 @@ func (fb *Framebuffer) DrawTexturedTriangle(tri Triangle, texture Texture) {
 			}
 
 			for x := xStart; x < xEnd; x++ {
-				fb.DrawTexel(x, y, a, b, c, at, bt, ct, tri.LightIntensity, tri.Palette, texture)
+				fb.DrawTexel(x, y, a, b, c, at, bt, ct, tri.LightIntensity, tri.Palette, tri.BlendMode, texture)
 			}
 		}
 	}
@@ -406,7 +427,7 @@ func (fb *Framebuffer) DrawTexturedTriangle(tri Triangle, texture Texture) {
 			}
 
 			for x := xStart; x < xEnd; x++ {
-				fb.DrawTexel(x, y, a, b, c, at, bt, ct, tri.LightIntensity, tri.Palette, texture)
+				fb.DrawTexel(x, y, a, b, c, at, bt, ct, tri.LightIntensity, tri.Palette, tri.BlendMode, texture)
 			}
 		}
 	}
@@ -0,0 +1,182 @@
+// This file contains a way to encode rendered frames as an animated GIF.
+//
+// GIF frames have at most 256 colors. The palette is made from the colors of
+// every frame with median cut, so it fits the scene instead of being a fixed
+// palette like palette.Plan9.
+package heretic
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"sort"
+)
+
+// WriteGIF encodes the frames as a looping animated GIF. delay is the time
+// between frames in 100ths of a second. Every frame shares one palette.
+func WriteGIF(w io.Writer, frames []*image.NRGBA, delay int) error {
+	hist := colorHistogram(frames)
+	pal := medianCut(hist, 256)
+
+	// The palette lookup is slow, but scenes repeat a lot of colors.
+	lookup := make(map[color.NRGBA]uint8, len(hist))
+	anim := &gif.GIF{}
+	for _, frame := range frames {
+		img := image.NewPaletted(frame.Bounds(), pal)
+		b := frame.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := opaque(frame.NRGBAAt(x, y))
+				idx, ok := lookup[c]
+				if !ok {
+					idx = uint8(pal.Index(c))
+					lookup[c] = idx
+				}
+				img.SetColorIndex(x, y, idx)
+			}
+		}
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// opaque drops the alpha of the color. The framebuffer is always opaque, but
+// blending can leave other values.
+func opaque(c color.NRGBA) color.NRGBA {
+	c.A = 255
+	return c
+}
+
+// colorCount is a color and how many pixels have it.
+type colorCount struct {
+	c     color.NRGBA
+	count int
+}
+
+func colorHistogram(frames []*image.NRGBA) []colorCount {
+	counts := map[color.NRGBA]int{}
+	for _, frame := range frames {
+		b := frame.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				counts[opaque(frame.NRGBAAt(x, y))]++
+			}
+		}
+	}
+	hist := make([]colorCount, 0, len(counts))
+	for c, n := range counts {
+		hist = append(hist, colorCount{c, n})
+	}
+	// Map order is random, sort so the palette is the same every time.
+	sort.Slice(hist, func(i, j int) bool {
+		a, b := hist[i].c, hist[j].c
+		if a.R != b.R {
+			return a.R < b.R
+		}
+		if a.G != b.G {
+			return a.G < b.G
+		}
+		return a.B < b.B
+	})
+	return hist
+}
+
+// medianCut returns a palette of at most n colors. The box of colors with the
+// widest channel is split in two at the median pixel until there are n boxes,
+// and each box becomes the average of its colors. Histograms that already fit
+// are used as they are.
+func medianCut(hist []colorCount, n int) color.Palette {
+	if len(hist) <= n {
+		pal := make(color.Palette, len(hist))
+		for i, cc := range hist {
+			pal[i] = cc.c
+		}
+		if len(pal) == 0 {
+			pal = append(pal, ColorBlack)
+		}
+		return pal
+	}
+
+	boxes := [][]colorCount{hist}
+	for len(boxes) < n {
+		// Split the box with the widest channel. Boxes of one color
+		// can't be split.
+		best, bestChannel, bestRange := -1, 0, 0
+		for i, box := range boxes {
+			channel, r := widestChannel(box)
+			if len(box) > 1 && r > bestRange {
+				best, bestChannel, bestRange = i, channel, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.SliceStable(box, func(i, j int) bool {
+			return channelValue(box[i].c, bestChannel) < channelValue(box[j].c, bestChannel)
+		})
+		total := 0
+		for _, cc := range box {
+			total += cc.count
+		}
+		split, seen := 1, 0
+		for i, cc := range box[:len(box)-1] {
+			seen += cc.count
+			if seen*2 >= total {
+				split = i + 1
+				break
+			}
+		}
+		boxes[best] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	pal := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		var r, g, b, total int
+		for _, cc := range box {
+			r += int(cc.c.R) * cc.count
+			g += int(cc.c.G) * cc.count
+			b += int(cc.c.B) * cc.count
+			total += cc.count
+		}
+		pal[i] = color.NRGBA{R: uint8(r / total), G: uint8(g / total), B: uint8(b / total), A: 255}
+	}
+	return pal
+}
+
+// widestChannel returns the channel (0 red, 1 green, 2 blue) with the largest
+// range of values in the box, and the range.
+func widestChannel(box []colorCount) (int, int) {
+	channel, widest := 0, -1
+	for ch := 0; ch < 3; ch++ {
+		min, max := 255, 0
+		for _, cc := range box {
+			v := channelValue(cc.c, ch)
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		if max-min > widest {
+			channel, widest = ch, max-min
+		}
+	}
+	return channel, widest
+}
+
+func channelValue(c color.NRGBA, channel int) int {
+	switch channel {
+	case 0:
+		return int(c.R)
+	case 1:
+		return int(c.G)
+	default:
+		return int(c.B)
+	}
+}
@@ -0,0 +1,63 @@
+package heretic
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestMedianCut(t *testing.T) {
+	var hist []colorCount
+	for i := 0; i < 1000; i++ {
+		hist = append(hist, colorCount{color.NRGBA{R: uint8(i), G: uint8(i / 4), B: uint8(i / 8), A: 255}, 1 + i%3})
+	}
+	pal := medianCut(hist, 16)
+	if len(pal) != 16 {
+		t.Fatalf("got %d colors, want 16", len(pal))
+	}
+
+	// Histograms that fit are used exactly.
+	pal = medianCut(hist[:10], 16)
+	if len(pal) != 10 || pal[3] != hist[3].c {
+		t.Errorf("palette = %v", pal)
+	}
+}
+
+func TestWriteGIF(t *testing.T) {
+	frames := make([]*image.NRGBA, 3)
+	for i := range frames {
+		img := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 32; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 8), G: uint8(y * 16), B: uint8(i * 100), A: 255})
+			}
+		}
+		frames[i] = img
+	}
+
+	var buf bytes.Buffer
+	if err := WriteGIF(&buf, frames, 5); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 3 || g.Delay[1] != 5 {
+		t.Fatalf("got %d frames with delay %v", len(g.Image), g.Delay)
+	}
+	if len(g.Image[0].Palette) > 256 {
+		t.Errorf("palette has %d colors", len(g.Image[0].Palette))
+	}
+
+	// 1536 colors in 256 is lossy, but every color should be close.
+	r, _, b, _ := g.Image[2].At(31, 0).RGBA()
+	if d := int(r>>8) - 248; d < -32 || d > 32 {
+		t.Errorf("red = %d, want about 248", r>>8)
+	}
+	if d := int(b>>8) - 200; d < -32 || d > 32 {
+		t.Errorf("blue = %d, want about 200", b>>8)
+	}
+}
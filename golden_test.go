@@ -0,0 +1,189 @@
+package heretic
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata/golden")
+
+// Size of the golden images.
+const (
+	goldenWidth  = 128
+	goldenHeight = 128
+)
+
+// Pixels match when every channel is within goldenTolerance. Rasterization can
+// differ by a pixel along edges between platforms, so a few pixels may not
+// match.
+const (
+	goldenTolerance     = 8
+	goldenMaxMismatched = 0.005
+)
+
+type goldenCamera struct {
+	name       string
+	eye        Vec3
+	orthoSize  float64
+	allModes   bool
+	renderMode RenderMode
+}
+
+var goldenCameras = []goldenCamera{
+	// The default camera of the engine, in every mode.
+	{name: "persp", eye: Vec3{X: -1, Y: 1, Z: -1}, allModes: true},
+	// Straight on from the front.
+	{name: "ortho", eye: Vec3{X: 0, Y: 0, Z: -2}, orthoSize: 2.5, renderMode: RenderModeTexture},
+}
+
+func TestGolden(t *testing.T) {
+	for _, asset := range []string{"cube", "f22", "crab", "drone"} {
+		mesh := NewMeshFromObj(filepath.Join("assets", asset+".obj"))
+		for _, camera := range goldenCameras {
+			for _, render := range []RenderMode{RenderModeTexture, RenderModeFill, RenderModeNone} {
+				for _, wire := range []WireMode{WireModeOff, WireModeOn} {
+					for _, cull := range []CullMode{CullModeNone, CullModeBackFace} {
+						if !camera.allModes && (render != camera.renderMode || wire != WireModeOff || cull != CullModeBackFace) {
+							continue
+						}
+						name := fmt.Sprintf("%s_%s_%s_wire-%s_cull-%s", asset, camera.name, render, wire, cull)
+						t.Run(name, func(t *testing.T) {
+							img := renderGolden(mesh, camera, render, wire, cull)
+							compareGolden(t, name, img)
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+// renderGolden renders a single frame of the mesh offscreen.
+func renderGolden(mesh Mesh, camera goldenCamera, render RenderMode, wire WireMode, cull CullMode) *image.NRGBA {
+	offscreen := NewOffscreen(goldenWidth, goldenHeight)
+	engine := NewEngine(offscreen, NewFramebuffer(goldenWidth, goldenHeight))
+	if camera.orthoSize > 0 {
+		engine.SetOrthographic(camera.orthoSize)
+	}
+	engine.SetCamera(camera.eye, Vec3{}, Vec3{Y: 1})
+	engine.SetRenderMode(render)
+	engine.SetWireMode(wire)
+	engine.SetCullMode(cull)
+
+	engine.SetMesh(mesh)
+	engine.Setup()
+	engine.Advance(0)
+	engine.Render()
+	return offscreen.Image()
+}
+
+// compareGolden compares the image to testdata/golden/name.png. With -update
+// the golden image is written instead. When they differ, the image and a diff
+// are written to a temporary directory so they can be looked at.
+func compareGolden(t *testing.T, name string, got *image.NRGBA) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name+".png")
+	if *update {
+		if err := writeTestPNG(path, got); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := readTestPNG(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if want.Bounds() != got.Bounds() {
+		t.Fatalf("image is %v, golden image is %v", got.Bounds(), want.Bounds())
+	}
+
+	diff, mismatched := diffImages(want, got)
+	total := got.Bounds().Dx() * got.Bounds().Dy()
+	if float64(mismatched) <= goldenMaxMismatched*float64(total) {
+		return
+	}
+
+	dir := filepath.Join(os.TempDir(), "heretic-golden")
+	if err := writeTestPNG(filepath.Join(dir, name+".png"), got); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTestPNG(filepath.Join(dir, name+"_diff.png"), diff); err != nil {
+		t.Fatal(err)
+	}
+	t.Errorf("%d of %d pixels differ from %s, see %s", mismatched, total, path, filepath.Join(dir, name+"_diff.png"))
+}
+
+// diffImages returns an image that is the golden image faded to gray with the
+// pixels that differ in red, and the number of pixels that differ.
+func diffImages(want, got *image.NRGBA) (*image.NRGBA, int) {
+	b := want.Bounds()
+	diff := image.NewNRGBA(b)
+	mismatched := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			w, g := want.NRGBAAt(x, y), got.NRGBAAt(x, y)
+			if channelDiff(w.R, g.R) > goldenTolerance || channelDiff(w.G, g.G) > goldenTolerance ||
+				channelDiff(w.B, g.B) > goldenTolerance || channelDiff(w.A, g.A) > goldenTolerance {
+				mismatched++
+				diff.SetNRGBA(x, y, ColorRed)
+				continue
+			}
+			gray := uint8((int(w.R) + int(w.G) + int(w.B)) / 3 / 4)
+			diff.SetNRGBA(x, y, color.NRGBA{R: gray, G: gray, B: gray, A: 255})
+		}
+	}
+	return diff, mismatched
+}
+
+func channelDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+func readTestPNG(path string) (*image.NRGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if nrgba, ok := img.(*image.NRGBA); ok {
+		return nrgba, nil
+	}
+	// PNGs of opaque images decode as RGBA.
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			nrgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return nrgba, nil
+}
+
+func writeTestPNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,261 @@
+// This file contains the input layer of the engine.
+//
+// Keys and mouse buttons aren't handled directly. They are bound to named
+// actions, like "next-map", and the engine only reacts to actions. This way
+// controls can be rebound with a JSON file and the engine can be driven by
+// something other than SDL, like a recording.
+package heretic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+type Action int
+
+const (
+	ActionNone Action = iota
+	ActionQuit
+	ActionToggleWire
+	ActionNextRenderMode
+	ActionNextCullMode
+	ActionNextMap
+	ActionPrevMap
+	ActionNextMapState
+	ActionPrevMapState
+	ActionToggleRotation
+	ActionZoomIn
+	ActionZoomOut
+	// ActionOrbit turns the camera around its target by the X and Y of the
+	// event. Bound to a mouse button, it orbits while the button is held
+	// and the mouse moves.
+	ActionOrbit
+	// ActionNextTile and ActionPrevTile step the highlighted terrain tile
+	// through the tiles of the scene. Stepping past either end clears it.
+	ActionNextTile
+	ActionPrevTile
+	ActionMax
+)
+
+var actionNames = []string{
+	"none",
+	"quit",
+	"toggle-wire",
+	"next-render-mode",
+	"next-cull-mode",
+	"next-map",
+	"prev-map",
+	"next-map-state",
+	"prev-map-state",
+	"toggle-rotation",
+	"zoom-in",
+	"zoom-out",
+	"orbit",
+	"next-tile",
+	"prev-tile",
+}
+
+func (a Action) String() string { return modeName(actionNames, int(a)) }
+
+// ParseAction returns the action with the name, like "next-map".
+func ParseAction(s string) (Action, error) {
+	for i, name := range actionNames {
+		if name == s {
+			return Action(i), nil
+		}
+	}
+	return ActionNone, fmt.Errorf("unknown action %q, expected one of %s", s, strings.Join(actionNames, ", "))
+}
+
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Action) UnmarshalText(text []byte) error {
+	action, err := ParseAction(string(text))
+	if err != nil {
+		return err
+	}
+	*a = action
+	return nil
+}
+
+// ActionEvent is an action that happened. X and Y are only used by actions
+// with an amount, like ActionOrbit.
+type ActionEvent struct {
+	Action Action  `json:"action"`
+	X      float64 `json:"x,omitempty"`
+	Y      float64 `json:"y,omitempty"`
+}
+
+// Bindings maps inputs to actions. Inputs are named:
+//
+//   - keys by their letter, like "w", or one of escape, space, return, tab,
+//     backspace, left, right, up and down
+//   - mouse buttons as mouse-left, mouse-middle and mouse-right
+//   - the mouse wheel as wheel-up and wheel-down
+//
+// In JSON, bindings are an object of input names to action names:
+//
+//	{"escape": "quit", "w": "toggle-wire", "mouse-right": "orbit"}
+type Bindings map[string]Action
+
+// DefaultBindings returns the controls the engine starts with.
+func DefaultBindings() Bindings {
+	return Bindings{
+		"escape":     ActionQuit,
+		"w":          ActionToggleWire,
+		"r":          ActionNextRenderMode,
+		"c":          ActionNextCullMode,
+		"k":          ActionNextMap,
+		"j":          ActionPrevMap,
+		"l":          ActionNextMapState,
+		"h":          ActionPrevMapState,
+		"space":      ActionToggleRotation,
+		"wheel-up":   ActionZoomIn,
+		"wheel-down": ActionZoomOut,
+		"mouse-left": ActionOrbit,
+		"t":          ActionNextTile,
+		"y":          ActionPrevTile,
+	}
+}
+
+// ReadBindings reads bindings from JSON. They replace the default bindings,
+// they aren't added to them.
+func ReadBindings(r io.Reader) (Bindings, error) {
+	var b Bindings
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, fmt.Errorf("bindings: %w", err)
+	}
+	for input := range b {
+		if !validInput(input) {
+			return nil, fmt.Errorf("bindings: unknown input %q", input)
+		}
+	}
+	return b, nil
+}
+
+// LoadBindings reads bindings from a JSON file.
+func LoadBindings(filename string) (Bindings, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBindings(f)
+}
+
+var keyNames = map[sdl.Keycode]string{
+	sdl.K_ESCAPE:    "escape",
+	sdl.K_SPACE:     "space",
+	sdl.K_RETURN:    "return",
+	sdl.K_TAB:       "tab",
+	sdl.K_BACKSPACE: "backspace",
+	sdl.K_LEFT:      "left",
+	sdl.K_RIGHT:     "right",
+	sdl.K_UP:        "up",
+	sdl.K_DOWN:      "down",
+}
+
+var buttonNames = map[uint8]string{
+	sdl.BUTTON_LEFT:   "mouse-left",
+	sdl.BUTTON_MIDDLE: "mouse-middle",
+	sdl.BUTTON_RIGHT:  "mouse-right",
+}
+
+// keyName returns the input name of the key. Letter and digit keycodes are
+// their ASCII values.
+func keyName(key sdl.Keycode) (string, bool) {
+	if name, ok := keyNames[key]; ok {
+		return name, true
+	}
+	if (key >= 'a' && key <= 'z') || (key >= '0' && key <= '9') {
+		return string(rune(key)), true
+	}
+	return "", false
+}
+
+func validInput(input string) bool {
+	if input == "wheel-up" || input == "wheel-down" {
+		return true
+	}
+	for _, name := range keyNames {
+		if name == input {
+			return true
+		}
+	}
+	for _, name := range buttonNames {
+		if name == input {
+			return true
+		}
+	}
+	return len(input) == 1 && ((input[0] >= 'a' && input[0] <= 'z') || (input[0] >= '0' && input[0] <= '9'))
+}
+
+// SDLInput translates SDL events into actions with the bindings.
+type SDLInput struct {
+	bindings Bindings
+
+	// Mouse buttons that are held down. Actions with an amount, like
+	// ActionOrbit, happen when the mouse moves while they are held.
+	held map[uint8]bool
+}
+
+func NewSDLInput(bindings Bindings) *SDLInput {
+	return &SDLInput{bindings: bindings, held: map[uint8]bool{}}
+}
+
+// Translate returns the actions of the event. Closing the window always
+// quits, no matter the bindings.
+func (in *SDLInput) Translate(event sdl.Event) []ActionEvent {
+	switch t := event.(type) {
+	case *sdl.QuitEvent:
+		return []ActionEvent{{Action: ActionQuit}}
+	case *sdl.MouseWheelEvent:
+		// Scrolling sideways has no vertical amount and isn't bound.
+		switch {
+		case t.PreciseY > 0:
+			return in.press("wheel-up")
+		case t.PreciseY < 0:
+			return in.press("wheel-down")
+		}
+	case *sdl.MouseButtonEvent:
+		name, ok := buttonNames[t.Button]
+		if !ok {
+			return nil
+		}
+		in.held[t.Button] = t.Type == sdl.MOUSEBUTTONDOWN
+		if t.Type == sdl.MOUSEBUTTONDOWN && in.bindings[name] != ActionOrbit {
+			return in.press(name)
+		}
+	case *sdl.MouseMotionEvent:
+		var events []ActionEvent
+		for button, down := range in.held {
+			if down && in.bindings[buttonNames[button]] == ActionOrbit {
+				events = append(events, ActionEvent{Action: ActionOrbit, X: float64(t.XRel), Y: float64(t.YRel)})
+			}
+		}
+		return events
+	case *sdl.KeyboardEvent:
+		if t.Type != sdl.KEYDOWN {
+			return nil
+		}
+		if name, ok := keyName(t.Keysym.Sym); ok {
+			return in.press(name)
+		}
+	}
+	return nil
+}
+
+func (in *SDLInput) press(input string) []ActionEvent {
+	action := in.bindings[input]
+	if action == ActionNone {
+		return nil
+	}
+	return []ActionEvent{{Action: action}}
+}
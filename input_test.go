@@ -0,0 +1,120 @@
+package heretic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func TestReadBindings(t *testing.T) {
+	got, err := ReadBindings(strings.NewReader(`{"q": "quit", "mouse-right": "orbit", "f": "toggle-wire"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Bindings{"q": ActionQuit, "mouse-right": ActionOrbit, "f": ActionToggleWire}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bindings = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{
+		`{"q": "fly"}`,
+		`{"f13": "quit"}`,
+		`{"q": 1}`,
+	} {
+		if _, err := ReadBindings(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadBindings(%s) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestSDLInputTranslate(t *testing.T) {
+	in := NewSDLInput(Bindings{"q": ActionQuit, "wheel-up": ActionZoomIn, "wheel-down": ActionZoomOut, "mouse-right": ActionOrbit, "mouse-left": ActionNextMap})
+	tests := []struct {
+		name  string
+		event sdl.Event
+		want  []ActionEvent
+	}{
+		{"bound key", &sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Sym: sdl.K_q}}, []ActionEvent{{Action: ActionQuit}}},
+		{"key up", &sdl.KeyboardEvent{Type: sdl.KEYUP, Keysym: sdl.Keysym{Sym: sdl.K_q}}, nil},
+		{"unbound key", &sdl.KeyboardEvent{Type: sdl.KEYDOWN, Keysym: sdl.Keysym{Sym: sdl.K_w}}, nil},
+		{"wheel up", &sdl.MouseWheelEvent{PreciseY: 1}, []ActionEvent{{Action: ActionZoomIn}}},
+		{"wheel down", &sdl.MouseWheelEvent{PreciseY: -1}, []ActionEvent{{Action: ActionZoomOut}}},
+		{"wheel sideways", &sdl.MouseWheelEvent{PreciseY: 0}, nil},
+		{"move without a button", &sdl.MouseMotionEvent{XRel: 3, YRel: 4}, nil},
+		{"press a button", &sdl.MouseButtonEvent{Type: sdl.MOUSEBUTTONDOWN, Button: sdl.BUTTON_LEFT}, []ActionEvent{{Action: ActionNextMap}}},
+		{"press the orbit button", &sdl.MouseButtonEvent{Type: sdl.MOUSEBUTTONDOWN, Button: sdl.BUTTON_RIGHT}, nil},
+		{"drag", &sdl.MouseMotionEvent{XRel: 3, YRel: 4}, []ActionEvent{{Action: ActionOrbit, X: 3, Y: 4}}},
+		{"release", &sdl.MouseButtonEvent{Type: sdl.MOUSEBUTTONUP, Button: sdl.BUTTON_RIGHT}, nil},
+		{"move after release", &sdl.MouseMotionEvent{XRel: 3, YRel: 4}, nil},
+		{"quit", &sdl.QuitEvent{}, []ActionEvent{{Action: ActionQuit}}},
+	}
+	for _, tt := range tests {
+		if got := in.Translate(tt.event); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Translate() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleAction(t *testing.T) {
+	engine, _ := newClockTestEngine(NewFakeClock())
+	engine.SetRenderMode(RenderModeFill)
+	engine.SetWireMode(WireModeOff)
+
+	// Going to render mode none turns on wire mode, and leaving it turns
+	// it off again.
+	engine.HandleAction(ActionEvent{Action: ActionNextRenderMode})
+	if engine.renderMode != RenderModeNone || engine.wireMode != WireModeOn {
+		t.Errorf("modes = %v %v, want none on", engine.renderMode, engine.wireMode)
+	}
+
+	// Wire mode turned on by hand stays on, even while another engine
+	// turned it on automatically.
+	other, _ := newClockTestEngine(NewFakeClock())
+	other.SetRenderMode(RenderModeNone)
+	other.SetWireMode(WireModeOn)
+	other.HandleAction(ActionEvent{Action: ActionNextRenderMode})
+	if other.wireMode != WireModeOn {
+		t.Errorf("other engine's wire mode = %v, want on", other.wireMode)
+	}
+
+	engine.HandleAction(ActionEvent{Action: ActionNextRenderMode})
+	if engine.renderMode != RenderModeTexture || engine.wireMode != WireModeOff {
+		t.Errorf("modes = %v %v, want texture off", engine.renderMode, engine.wireMode)
+	}
+
+	scale := engine.scene.Meshes[0].Scale
+	engine.HandleAction(ActionEvent{Action: ActionZoomIn})
+	if got := engine.scene.Meshes[0].Scale; got.X <= scale.X {
+		t.Errorf("scale after zoom in = %v, was %v", got, scale)
+	}
+
+	engine.HandleAction(ActionEvent{Action: ActionQuit})
+	if engine.IsRunning {
+		t.Error("engine is running after quit")
+	}
+}
+
+func TestStepTile(t *testing.T) {
+	engine, _ := newClockTestEngine(NewFakeClock())
+	a, b := TileLocation{X: 1, Z: 2}, TileLocation{X: 3, Z: 0, Level: 1}
+	engine.SetMesh(Mesh{Triangles: []Triangle{
+		{Tile: &a}, {}, {Tile: &b}, {Tile: &TileLocation{X: 1, Z: 2}},
+	}})
+
+	var got []*TileLocation
+	for i := 0; i < 4; i++ {
+		engine.HandleAction(ActionEvent{Action: ActionNextTile})
+		got = append(got, engine.SelectedTile())
+	}
+	if want := []*TileLocation{&a, &b, nil, &a}; !reflect.DeepEqual(got, want) {
+		t.Errorf("next tiles = %v, want %v", got, want)
+	}
+
+	engine.SelectTile(nil)
+	engine.HandleAction(ActionEvent{Action: ActionPrevTile})
+	if got := engine.SelectedTile(); got == nil || *got != b {
+		t.Errorf("previous tile = %v, want %v", got, b)
+	}
+}
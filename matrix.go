@@ -139,14 +139,17 @@ func MatrixMakePerspective(fov, aspect, znear, zfar float64) Matrix {
 	return m
 }
 
+// MatrixMakeOrtho maps the box to X and Y of -1 to 1 and Z of 0 to 1, like
+// MatrixMakePerspective does for its frustum. W stays 1, so the perspective
+// divide does nothing.
 func MatrixMakeOrtho(left, right, bottom, top, near, far float64) Matrix {
 	m := MatrixIdentity()
 	m[0][0] = 2 / (right - left)
 	m[1][1] = 2 / (top - bottom)
-	m[2][2] = -2 / (far - near)
+	m[2][2] = 1 / (far - near)
 	m[0][3] = -(right + left) / (right - left)
 	m[1][3] = -(top + bottom) / (top - bottom)
-	m[2][3] = -(far + near) / (far - near)
+	m[2][3] = -near / (far - near)
 	return m
 }
 
@@ -4,13 +4,13 @@ import (
 	"math"
 )
 
-func NewMesh(triangles []Triangle, texture Texture) Mesh {
+func NewMesh(triangles []Triangle, texture Sampler) Mesh {
 	return Mesh{Triangles: triangles, Texture: texture}
 }
 
 type Mesh struct {
 	Triangles  []Triangle
-	Texture    Texture
+	Texture    Sampler
 	Background *Background
 
 	DirectionalLights []DirectionalLight
@@ -20,9 +20,25 @@ type Mesh struct {
 	Scale       Vec3
 	Translation Vec3
 
+	// previousRotation is Rotation before the last simulation step. The
+	// engine draws the mesh between the two.
+	previousRotation Vec3
+
 	trianglesToRender []Triangle
 }
 
+// TileTriangles returns the indexes of the triangles that sit on the terrain
+// tile.
+func (m *Mesh) TileTriangles(loc TileLocation) []int {
+	indexes := []int{}
+	for i, t := range m.Triangles {
+		if t.Tile != nil && *t.Tile == loc {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
 // NormalizeCoordinates normalizes all vertex coordinates between 0 and 1. This
 // scales down large models during import.  This is primary used for loading FFT
 // maps since they have very large coordinates.  The min/max values should be
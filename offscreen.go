@@ -0,0 +1,36 @@
+package heretic
+
+import "image"
+
+// Offscreen is a display without a window. It keeps the last rendered frame
+// so it can be saved, which allows rendering without a screen.
+type Offscreen struct {
+	width, height int
+	frame         *image.NRGBA
+}
+
+// NewOffscreen returns a display of the size that never shows anything.
+func NewOffscreen(width, height int) *Offscreen {
+	return &Offscreen{
+		width:  width,
+		height: height,
+		frame:  image.NewNRGBA(image.Rect(0, 0, width, height)),
+	}
+}
+
+// Size returns the size of the display in pixels.
+func (o *Offscreen) Size() (width, height int) {
+	return o.width, o.height
+}
+
+// Update copies the framebuffer as the last frame.
+func (o *Offscreen) Update(framebuffer *Framebuffer) {
+	o.frame = framebuffer.Image()
+}
+
+// Image returns the last frame.
+func (o *Offscreen) Image() *image.NRGBA {
+	return o.frame
+}
+
+func (o *Offscreen) Destroy() {}
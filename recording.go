@@ -0,0 +1,242 @@
+// This file contains recording the actions of a session and replaying them.
+//
+// A recording is JSON lines. The first line is the scene the recording starts
+// with. Each line after it is an action, the end of a frame or a scene that
+// was loaded, with the time in nanoseconds since the recording started:
+//
+//	{"header":{"file":"fft.bin","map":1,"state":0,"width":800,"height":800,...}}
+//	{"time":4000000,"action":"orbit","x":3,"y":-1}
+//	{"time":16000000,"frame":true}
+//	{"time":20000000,"action":"next-map"}
+//	{"time":310000000,"load":true}
+//
+// Every frame is recorded, not only the ones with actions, because the time
+// of each frame changes how far the scene moves. Loading a map takes time that
+// isn't part of a frame, so when it is done is recorded too. Replaying the
+// actions at the same times on a FakeClock gives the same frames as the
+// session.
+package heretic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RecordingHeader is the scene a recording starts with.
+type RecordingHeader struct {
+	// File is the OBJ file or FFT image that was viewed.
+	File string `json:"file"`
+
+	// Map and State are the FFT map and the index of its state. Map is -1
+	// when no map was loaded, like for OBJ files.
+	Map   int `json:"map"`
+	State int `json:"state"`
+
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// FOV is the vertical field of view in radians. When Ortho is set, the
+	// projection is orthographic and Ortho units high instead.
+	FOV   float64 `json:"fov,omitempty"`
+	Ortho float64 `json:"ortho,omitempty"`
+
+	Eye    Vec3 `json:"eye"`
+	Target Vec3 `json:"target"`
+	Up     Vec3 `json:"up"`
+
+	RenderMode   RenderMode    `json:"render"`
+	WireMode     WireMode      `json:"wire"`
+	CullMode     CullMode      `json:"cull"`
+	AutoRotation bool          `json:"autoRotation"`
+	Rotation     Vec3          `json:"rotation"`
+	Tile         *TileLocation `json:"tile,omitempty"`
+}
+
+// Recording is the scene a recording starts with and what happened after.
+type Recording struct {
+	Header RecordingHeader
+	Events []RecordedEvent
+}
+
+// RecordedEvent is an action, the end of a frame when Frame is set or the end
+// of loading a scene when Load is set.
+type RecordedEvent struct {
+	Time  time.Duration `json:"time"`
+	Frame bool          `json:"frame,omitempty"`
+	Load  bool          `json:"load,omitempty"`
+	ActionEvent
+}
+
+// headerLine is the first line of a recording.
+type headerLine struct {
+	Header *RecordingHeader `json:"header"`
+}
+
+// Recorder writes the events of a recording. Write errors are kept and
+// returned by Close, so recording doesn't interrupt the session.
+type Recorder struct {
+	w     *bufio.Writer
+	enc   *json.Encoder
+	start time.Duration
+	err   error
+}
+
+func newRecorder(w io.Writer, start time.Duration, header RecordingHeader) *Recorder {
+	bw := bufio.NewWriter(w)
+	r := &Recorder{w: bw, enc: json.NewEncoder(bw), start: start}
+	r.err = r.enc.Encode(headerLine{Header: &header})
+	return r
+}
+
+func (r *Recorder) record(now time.Duration, event RecordedEvent) {
+	if r.err != nil {
+		return
+	}
+	event.Time = now - r.start
+	r.err = r.enc.Encode(event)
+}
+
+// Close writes what is left of the recording and returns the first error.
+func (r *Recorder) Close() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.w.Flush()
+}
+
+// ReadRecording reads a recording.
+func ReadRecording(r io.Reader) (*Recording, error) {
+	dec := json.NewDecoder(r)
+	var line headerLine
+	if err := dec.Decode(&line); err != nil {
+		return nil, fmt.Errorf("recording: header: %w", err)
+	}
+	if line.Header == nil {
+		return nil, fmt.Errorf("recording: no header")
+	}
+
+	rec := &Recording{Header: *line.Header}
+	for {
+		var event RecordedEvent
+		err := dec.Decode(&event)
+		if err == io.EOF {
+			return rec, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("recording: event %d: %w", len(rec.Events)+1, err)
+		}
+		if len(rec.Events) > 0 && event.Time < rec.Events[len(rec.Events)-1].Time {
+			return nil, fmt.Errorf("recording: event %d: time goes backwards", len(rec.Events)+1)
+		}
+		rec.Events = append(rec.Events, event)
+	}
+}
+
+// Replay plays a recording back into an engine. The clock must be the
+// engine's clock, it is moved to the time of each event.
+type Replay struct {
+	events []RecordedEvent
+	next   int
+	clock  *FakeClock
+	start  time.Duration
+}
+
+// NewReplay sets the engine up with the scene of the recording and starts it,
+// like Engine.Record(). The engine must have the size of the recording and
+// either its mesh set or a MeshReader for the map of the recording.
+func NewReplay(rec *Recording, engine *Engine, clock *FakeClock) *Replay {
+	engine.setRecordingHeader(rec.Header)
+	return &Replay{events: rec.Events, clock: clock, start: engine.previous}
+}
+
+// NextFrame does the actions of the next frame, each at the time it was
+// recorded, and moves the clock to the end of the frame. It is called instead
+// of ProcessInput(), so Update() gets the same frame time as when it was
+// recorded. It returns false when there are no frames left.
+func (r *Replay) NextFrame(engine *Engine) bool {
+	for r.next < len(r.events) {
+		event := r.events[r.next]
+		r.next++
+		r.clock.Advance(r.start + event.Time - r.clock.Now())
+		switch {
+		case event.Frame:
+			return true
+		case event.Load:
+			// The scene was loaded when the action was done, but
+			// started as late as loading took in the session.
+			engine.previous = r.clock.Now()
+		default:
+			engine.HandleAction(event.ActionEvent)
+		}
+	}
+	return false
+}
+
+// Record starts writing the scene, actions and frames of the engine to w.
+// file is the OBJ file or FFT image being viewed, so a replay can load it.
+// The recording starts at the time of the last frame, so it is best started
+// right after Setup(). Stop it with StopRecording().
+func (e *Engine) Record(w io.Writer, file string) {
+	e.recorder = newRecorder(w, e.previous, e.recordingHeader(file))
+}
+
+// StopRecording stops the recording and returns the first error writing it.
+func (e *Engine) StopRecording() error {
+	if e.recorder == nil {
+		return nil
+	}
+	err := e.recorder.Close()
+	e.recorder = nil
+	return err
+}
+
+// recordingHeader returns the header of a recording of the engine as it is now.
+func (e *Engine) recordingHeader(file string) RecordingHeader {
+	h := RecordingHeader{
+		File:         file,
+		Map:          e.currentMap,
+		State:        e.currentState,
+		Width:        e.width,
+		Height:       e.height,
+		FOV:          e.fovY,
+		Eye:          e.camera.eye,
+		Target:       e.camera.front,
+		Up:           e.camera.up,
+		RenderMode:   e.renderMode,
+		WireMode:     e.wireMode,
+		CullMode:     e.cullMode,
+		AutoRotation: e.autoRotation,
+		Rotation:     e.rotation,
+		Tile:         e.selectedTile,
+	}
+	if e.orthographic {
+		h.FOV, h.Ortho = 0, e.orthoHeight
+	}
+	return h
+}
+
+// setRecordingHeader sets the engine up like the header and loads its map, or sets up
+// the mesh that is already set.
+func (e *Engine) setRecordingHeader(h RecordingHeader) {
+	if h.Ortho > 0 {
+		e.SetOrthographic(h.Ortho)
+	} else if h.FOV > 0 {
+		e.SetFOV(h.FOV)
+	}
+	e.SetCamera(h.Eye, h.Target, h.Up)
+	e.SetRenderMode(h.RenderMode)
+	e.SetWireMode(h.WireMode)
+	e.SetCullMode(h.CullMode)
+	e.autoRotation = h.AutoRotation
+	e.rotation = h.Rotation
+	e.SelectTile(h.Tile)
+
+	if e.MeshReader != nil && h.Map >= 0 {
+		e.LoadMap(h.Map, h.State)
+		return
+	}
+	e.Setup()
+}
@@ -0,0 +1,191 @@
+package heretic
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	// A session with frames of different lengths and actions in between.
+	var buf bytes.Buffer
+	clock := NewFakeClock()
+	engine, _ := newClockTestEngine(clock)
+	clock.Advance(time.Second)
+	engine.Record(&buf, "cube.obj")
+	session := []struct {
+		wait    time.Duration
+		actions []ActionEvent
+	}{
+		{5 * time.Millisecond, []ActionEvent{{Action: ActionOrbit, X: 12, Y: -3}}},
+		{30 * time.Millisecond, nil},
+		{0, []ActionEvent{{Action: ActionToggleWire}, {Action: ActionZoomIn}}},
+		{100 * time.Millisecond, []ActionEvent{{Action: ActionOrbit, X: -40, Y: 9}, {Action: ActionToggleRotation}}},
+		{7 * time.Millisecond, nil},
+	}
+	for _, frame := range session {
+		clock.Advance(frame.wait)
+		for _, action := range frame.actions {
+			engine.HandleAction(action)
+		}
+		engine.Update()
+		engine.Render()
+	}
+	if err := engine.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	want := engine.Image()
+
+	rec, err := ReadRecording(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(rec.Events), len(session)+5; got != want {
+		t.Fatalf("recorded %d events, want %d", got, want)
+	}
+
+	clock = NewFakeClock()
+	replayed, _ := newClockTestEngine(clock)
+	replay := NewReplay(rec, replayed, clock)
+	frames := 0
+	for replay.NextFrame(replayed) {
+		replayed.Update()
+		replayed.Render()
+		frames++
+	}
+	if frames != len(session) {
+		t.Errorf("replayed %d frames, want %d", frames, len(session))
+	}
+	if replayed.wireMode != engine.wireMode || replayed.autoRotation != engine.autoRotation {
+		t.Errorf("modes = %v %v, want %v %v", replayed.wireMode, replayed.autoRotation, engine.wireMode, engine.autoRotation)
+	}
+	if *replayed.camera != *engine.camera {
+		t.Errorf("camera = %+v, want %+v", *replayed.camera, *engine.camera)
+	}
+	if !bytes.Equal(replayed.Image().Pix, want.Pix) {
+		t.Error("last replayed frame differs from the recorded session")
+	}
+}
+
+// testMeshReader has two maps of two states each. Loading a map takes load
+// on the clock, like reading it from a disc takes time in a session.
+type testMeshReader struct {
+	clock *FakeClock
+	load  time.Duration
+}
+
+func (r testMeshReader) MapNums() []int              { return []int{1, 2} }
+func (r testMeshReader) NumMapStates(mapNum int) int { return 2 }
+
+func (r testMeshReader) ReadMeshState(mapNum, stateIdx int) Mesh {
+	if r.clock != nil {
+		r.clock.Advance(r.load)
+	}
+	asset := "cube.obj"
+	if mapNum == 2 {
+		asset = "f22.obj"
+	}
+	mesh := NewMeshFromObj(filepath.Join("assets", asset))
+	if stateIdx == 1 {
+		mesh.Background = &Background{Top: ColorBlue, Bottom: ColorRed}
+	}
+	return mesh
+}
+
+// TestReplayMapChange replays a session that changes maps into an engine that
+// isn't set up like the recorded one and loads maps without taking any time.
+func TestReplayMapChange(t *testing.T) {
+	var buf bytes.Buffer
+	clock := NewFakeClock()
+	engine := NewEngine(NewOffscreen(64, 64), NewFramebuffer(64, 64))
+	engine.SetClock(clock)
+	engine.MeshReader = testMeshReader{clock: clock, load: 300 * time.Millisecond}
+	engine.SetOrthographic(3)
+	engine.SetCamera(Vec3{X: 1, Y: 2, Z: -3}, Vec3{}, Vec3{Y: 1})
+	engine.SetWireMode(WireModeOn)
+	engine.SetCullMode(CullModeNone)
+	engine.SetAutoRotation(Vec3{Y: 1})
+	engine.SelectTile(&TileLocation{X: 1, Z: 2})
+	engine.LoadMap(1, 0)
+	clock.Advance(time.Second)
+	engine.Record(&buf, "maps.bin")
+
+	session := [][]ActionEvent{
+		{{Action: ActionOrbit, X: 5, Y: 1}},
+		{{Action: ActionNextMap}},
+		nil,
+		{{Action: ActionNextMapState}, {Action: ActionZoomIn}},
+		nil,
+		{{Action: ActionPrevMap}},
+		{{Action: ActionOrbit, X: -8, Y: 2}},
+	}
+	for _, actions := range session {
+		for _, action := range actions {
+			engine.HandleAction(action)
+		}
+		engine.Update()
+		engine.Render()
+	}
+	if err := engine.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	want := engine.Image()
+
+	rec, err := ReadRecording(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := rec.Header
+	if h.File != "maps.bin" || h.Map != 1 || h.State != 0 || h.Ortho != 3 || h.WireMode != WireModeOn || h.Tile == nil || *h.Tile != (TileLocation{X: 1, Z: 2}) {
+		t.Errorf("header = %+v", h)
+	}
+	loads := 0
+	for _, event := range rec.Events {
+		if event.Load {
+			loads++
+		}
+	}
+	if loads != 3 {
+		t.Errorf("recorded %d loads, want 3", loads)
+	}
+
+	clock = NewFakeClock()
+	replayed := NewEngine(NewOffscreen(64, 64), NewFramebuffer(64, 64))
+	replayed.SetClock(clock)
+	replayed.MeshReader = testMeshReader{}
+	replay := NewReplay(rec, replayed, clock)
+	for replay.NextFrame(replayed) {
+		replayed.Update()
+		replayed.Render()
+	}
+
+	if replayed.currentMap != engine.currentMap || replayed.currentState != engine.currentState {
+		t.Errorf("map = %d %d, want %d %d", replayed.currentMap, replayed.currentState, engine.currentMap, engine.currentState)
+	}
+	if got, want := replayed.scene.Meshes[0].Rotation, engine.scene.Meshes[0].Rotation; got != want {
+		t.Errorf("rotation = %v, want %v", got, want)
+	}
+	if *replayed.camera != *engine.camera {
+		t.Errorf("camera = %+v, want %+v", *replayed.camera, *engine.camera)
+	}
+	if !bytes.Equal(replayed.Image().Pix, want.Pix) {
+		t.Error("last replayed frame differs from the recorded session")
+	}
+}
+
+func TestReadRecordingErrors(t *testing.T) {
+	const header = `{"header":{"file":"cube.obj","map":-1}}` + "\n"
+	for _, bad := range []string{
+		``,
+		`{"time":5,"frame":true}`,
+		header + `{"time":5,"action":"fly"}`,
+		header + `{"time":5,"frame":true}` + "\n" + `{"time":4,"frame":true}`,
+		header + `{"time":`,
+	} {
+		if _, err := ReadRecording(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadRecording(%s) succeeded, want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package heretic
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMatrixMakeOrtho(t *testing.T) {
+	m := MatrixMakeOrtho(-2, 2, -1, 1, znear, zfar)
+	tests := []struct {
+		point, want Vec4
+	}{
+		{Vec4{X: -2, Y: -1, Z: znear, W: 1}, Vec4{X: -1, Y: -1, Z: 0, W: 1}},
+		{Vec4{X: 2, Y: 1, Z: zfar, W: 1}, Vec4{X: 1, Y: 1, Z: 1, W: 1}},
+		{Vec4{X: 1, Y: 0, Z: (znear + zfar) / 2, W: 1}, Vec4{X: 0.5, Y: 0, Z: 0.5, W: 1}},
+	}
+	for _, tt := range tests {
+		got := m.MulVec4(tt.point)
+		if !vec4Near(got, tt.want) {
+			t.Errorf("MulVec4(%+v) = %+v, want %+v", tt.point, got, tt.want)
+		}
+	}
+}
+
+func TestOrthoFrustum(t *testing.T) {
+	frustum := NewOrthoFrustum(4, 2, znear, zfar)
+	tests := []struct {
+		name   string
+		points []Vec4
+		want   int
+	}{
+		{"inside", []Vec4{{X: -1, Y: 0, Z: 1, W: 1}, {X: 1, Y: 0, Z: 1, W: 1}, {X: 0, Y: 0.5, Z: 1, W: 1}}, 1},
+		{"right of the box", []Vec4{{X: 3, Y: 0, Z: 1, W: 1}, {X: 4, Y: 0, Z: 1, W: 1}, {X: 3, Y: 0.5, Z: 1, W: 1}}, 0},
+		{"above the box", []Vec4{{X: 0, Y: 2, Z: 1, W: 1}, {X: 1, Y: 2, Z: 1, W: 1}, {X: 0, Y: 3, Z: 1, W: 1}}, 0},
+		{"in front of near", []Vec4{{X: 0, Y: 0, Z: 0.1, W: 1}, {X: 1, Y: 0, Z: 0.1, W: 1}, {X: 0, Y: 0.5, Z: 0.1, W: 1}}, 0},
+		{"behind far", []Vec4{{X: 0, Y: 0, Z: 200, W: 1}, {X: 1, Y: 0, Z: 200, W: 1}, {X: 0, Y: 0.5, Z: 200, W: 1}}, 0},
+	}
+	for _, tt := range tests {
+		tri := Triangle{Projected: tt.points, Texcoords: make([]Tex, 3)}
+		if got := frustum.Clip(tri); len(got) != tt.want {
+			t.Errorf("%s: Clip() = %d triangles, want %d", tt.name, len(got), tt.want)
+		}
+	}
+
+	// A triangle across the right side is cut at the side. Unlike the
+	// perspective frustum, the sides don't widen with the distance.
+	tri := Triangle{
+		Projected: []Vec4{{X: 0, Y: 0, Z: 50, W: 1}, {X: 4, Y: 0, Z: 50, W: 1}, {X: 0, Y: 0.5, Z: 50, W: 1}},
+		Texcoords: make([]Tex, 3),
+	}
+	clipped := frustum.Clip(tri)
+	if len(clipped) == 0 {
+		t.Fatal("Clip() removed a triangle across the right side")
+	}
+	for _, c := range clipped {
+		for _, p := range c.Projected {
+			if p.X > 2+1e-9 {
+				t.Errorf("clipped point %+v is right of the box", p)
+			}
+		}
+	}
+}
+
+// TestOrthoBackFace culls a triangle by its facing alone. The triangle is
+// almost edge on, so a ray from the eye to it, like the perspective projection
+// uses, would cull it on one side of the view and not on the other.
+func TestOrthoBackFace(t *testing.T) {
+	const angle = 80 * math.Pi / 180
+	tilted := func(x float64, front bool) Triangle {
+		a := Vec3{X: x, Y: 0, Z: 0}
+		b := Vec3{X: x, Y: 1, Z: 0}
+		c := Vec3{X: x + math.Cos(angle), Y: 0, Z: math.Sin(angle)}
+		if !front {
+			b, c = c, b
+		}
+		return Triangle{Points: []Vec3{a, b, c}, Texcoords: make([]Tex, 3)}
+	}
+
+	for _, x := range []float64{-20, 0, 20} {
+		for _, front := range []bool{true, false} {
+			engine := NewEngine(NewOffscreen(64, 64), NewFramebuffer(64, 64))
+			engine.SetOrthographic(60)
+			engine.SetCamera(Vec3{Z: -10}, Vec3{}, Vec3{Y: 1})
+			engine.SetMesh(Mesh{Triangles: []Triangle{tilted(x, front)}, Scale: Vec3{X: 1, Y: 1, Z: 1}})
+			engine.project(0)
+
+			want := 0
+			if front {
+				want = 1
+			}
+			if got := len(engine.scene.Meshes[0].trianglesToRender); got != want {
+				t.Errorf("x %v, front %v: projected %d triangles, want %d", x, front, got, want)
+			}
+		}
+	}
+}
+
+// TestDepthOrder draws a triangle that gets further away from left to right
+// with one at a constant depth. Each must win where it is nearer, no matter
+// the order they are drawn in, which needs the depth interpolated per pixel.
+func TestDepthOrder(t *testing.T) {
+	sloped := Triangle{Projected: []Vec4{{X: 0, Y: 0, Z: 0.1, W: 1}, {X: 63, Y: 0, Z: 0.9, W: 1}, {X: 0, Y: 63, Z: 0.1, W: 1}}}
+	flat := Triangle{Projected: []Vec4{{X: 0, Y: 0, Z: 0.5, W: 1}, {X: 63, Y: 0, Z: 0.5, W: 1}, {X: 0, Y: 63, Z: 0.5, W: 1}}}
+
+	for _, slopedFirst := range []bool{true, false} {
+		fb := NewFramebuffer(64, 64)
+		fb.Clear(ColorBlack)
+		fb.ClearDepth()
+		if slopedFirst {
+			fb.DrawFilledTriangle(sloped, ColorRed)
+			fb.DrawFilledTriangle(flat, ColorGreen)
+		} else {
+			fb.DrawFilledTriangle(flat, ColorGreen)
+			fb.DrawFilledTriangle(sloped, ColorRed)
+		}
+
+		img := fb.Image()
+		if got := img.NRGBAAt(5, 5); got != ColorRed {
+			t.Errorf("sloped first %v: near pixel = %v, want %v", slopedFirst, got, ColorRed)
+		}
+		if got := img.NRGBAAt(50, 5); got != ColorGreen {
+			t.Errorf("sloped first %v: far pixel = %v, want %v", slopedFirst, got, ColorGreen)
+		}
+	}
+}
+
+func TestOffscreen(t *testing.T) {
+	offscreen := NewOffscreen(4, 3)
+	if w, h := offscreen.Size(); w != 4 || h != 3 {
+		t.Errorf("Size() = %d, %d, want 4, 3", w, h)
+	}
+	if got := offscreen.Image().Bounds().Size(); got.X != 4 || got.Y != 3 {
+		t.Errorf("image before the first frame is %v, want 4x3", got)
+	}
+
+	fb := NewFramebuffer(4, 3)
+	fb.Clear(ColorBlue)
+	fb.DrawPixel(1, 2, ColorYellow)
+	offscreen.Update(fb)
+
+	// The frame is a copy, drawing afterwards doesn't change it.
+	fb.Clear(ColorBlack)
+	img := offscreen.Image()
+	if got := img.NRGBAAt(1, 2); got != ColorYellow {
+		t.Errorf("pixel = %v, want %v", got, ColorYellow)
+	}
+	if got := img.NRGBAAt(2, 1); got != ColorBlue {
+		t.Errorf("background = %v, want %v", got, ColorBlue)
+	}
+}
+
+func vec4Near(a, b Vec4) bool {
+	const e = 1e-9
+	return math.Abs(a.X-b.X) < e && math.Abs(a.Y-b.Y) < e && math.Abs(a.Z-b.Z) < e && math.Abs(a.W-b.W) < e
+}
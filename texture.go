@@ -14,10 +14,18 @@ type Tex struct {
 	U, V float64
 }
 
-func (t Tex) IsEmpty() bool {
-	return t.U == 0.0 && t.V == 0.0
+// Sampler is a texture the rasterizer can draw from. The clut is the palette
+// of the triangle being drawn. Textures that aren't indexed ignore it.
+type Sampler interface {
+	Width() int
+	Height() int
+
+	// Sample returns the texel at x, y and false if it is transparent and
+	// shouldn't be drawn.
+	Sample(x, y int, clut Palette) (PaletteColor, bool)
 }
 
+// Texture is a true color texture, like the PNGs next to OBJ files.
 type Texture struct {
 	width, height int
 	data          []color.NRGBA
@@ -27,6 +35,91 @@ func NewTexture(width, height int, data []color.NRGBA) Texture {
 	return Texture{width, height, data}
 }
 
+// Width returns the width of the texture in pixels.
+func (t Texture) Width() int { return t.width }
+
+// Height returns the height of the texture in pixels.
+func (t Texture) Height() int { return t.height }
+
+// Data returns the pixels of the texture, row by row.
+func (t Texture) Data() []color.NRGBA { return t.data }
+
+// Sample returns the color at x, y. Fully transparent pixels, like the
+// transparent palette colors of an exported FFT map, aren't drawn. Any other
+// alpha is drawn opaque.
+func (t Texture) Sample(x, y int, clut Palette) (PaletteColor, bool) {
+	c := t.data[y*t.width+x]
+	return PaletteColor{NRGBA: c}, c.A != 0
+}
+
+// IndexedTexture is a texture of palette indexes, like the PlayStation's 4bpp
+// and 8bpp textures. 4bpp textures pack two indexes in each byte, the low
+// nibble first, the same as they are stored on disc.
+//
+// Indexes are looked up in the clut the texture is sampled with, or in the
+// texture's own CLUT when that is nil. This allows every triangle to use a
+// different palette with the same texture.
+type IndexedTexture struct {
+	width, height int
+	bpp           int
+	pix           []byte
+	clut          Palette
+}
+
+// NewIndexedTexture returns a texture of the indexes in pix. bpp is 4 or 8 and
+// pix must have width*height*bpp/8 bytes. clut can be nil if every sample
+// provides one.
+func NewIndexedTexture(width, height, bpp int, pix []byte, clut Palette) IndexedTexture {
+	if bpp != 4 && bpp != 8 {
+		panic(fmt.Sprintf("indexed texture must be 4 or 8 bpp, got %d", bpp))
+	}
+	if len(pix) != width*height*bpp/8 {
+		panic(fmt.Sprintf("indexed texture %dx%d at %d bpp needs %d bytes, got %d", width, height, bpp, width*height*bpp/8, len(pix)))
+	}
+	return IndexedTexture{width, height, bpp, pix, clut}
+}
+
+// Width returns the width of the texture in pixels.
+func (t IndexedTexture) Width() int { return t.width }
+
+// Height returns the height of the texture in pixels.
+func (t IndexedTexture) Height() int { return t.height }
+
+// BitsPerPixel returns 4 or 8.
+func (t IndexedTexture) BitsPerPixel() int { return t.bpp }
+
+// Pix returns the packed indexes of the texture, row by row.
+func (t IndexedTexture) Pix() []byte { return t.pix }
+
+// CLUT returns the texture's own palette, which may be nil.
+func (t IndexedTexture) CLUT() Palette { return t.clut }
+
+// Index returns the palette index at x, y.
+func (t IndexedTexture) Index(x, y int) uint8 {
+	i := y*t.width + x
+	if t.bpp == 8 {
+		return t.pix[i]
+	}
+	b := t.pix[i/2]
+	if i%2 == 1 {
+		return b >> 4
+	}
+	return b & 0x0F
+}
+
+// Sample looks up the index at x, y in clut, or in the texture's CLUT if clut
+// is nil. Indexes outside of the palette and transparent colors aren't drawn.
+func (t IndexedTexture) Sample(x, y int, clut Palette) (PaletteColor, bool) {
+	if clut == nil {
+		clut = t.clut
+	}
+	idx := int(t.Index(x, y))
+	if idx >= len(clut) || isTransparent(clut[idx].NRGBA) {
+		return PaletteColor{}, false
+	}
+	return clut[idx], true
+}
+
 func NewTextureFromImage(image image.Image) Texture {
 	width := image.Bounds().Dx()
 	height := image.Bounds().Dy()
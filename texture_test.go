@@ -0,0 +1,19 @@
+package heretic
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestTextureSampleAlpha(t *testing.T) {
+	texture := NewTexture(2, 1, []color.NRGBA{
+		{R: 255, A: 255},
+		{R: 255, A: 0},
+	})
+	if c, ok := texture.Sample(0, 0, nil); !ok || c.R != 255 {
+		t.Errorf("opaque texel = %v, %v", c, ok)
+	}
+	if _, ok := texture.Sample(1, 0, nil); ok {
+		t.Error("fully transparent texel should not be drawn")
+	}
+}
@@ -13,18 +13,44 @@ type Triangle struct {
 
 	Texcoords []Tex
 
+	// Textured is true when Texcoords should be used. Texcoords are
+	// always allocated since clipping indexes them, so their presence
+	// doesn't tell us anything.
+	Textured bool
+
 	// Palette represents the 16-color Palette to use during rendering a
 	// polygon.  This is due to FFT texture storage. The raw texture pixel
 	// value is an index for a palettes. Each map has 16 palettes of 16
 	// colors each. Each polygon references on of the 16 palettes to use.
-	// Eventually Renderer.DrawTexel() function uses uses the pallet.
+	// It is passed to the texture's Sampler as the CLUT.
 	Palette Palette
 
 	// Color is used when there is no texture or when there is a texture,
 	// but the polygon has no palette.
 	Color color.NRGBA
 
+	// BlendMode is used for semi-transparent triangles. Textured triangles
+	// only blend texels that have the STP bit set in their palette.
+	// Untextured triangles blend every pixel.
+	BlendMode BlendMode
+
 	LightIntensity float64
+
+	// Tile is the terrain tile the triangle sits on. It is nil when the
+	// triangle isn't linked to terrain, which is everything except
+	// textured FFT polygons that sit on a tile.
+	Tile *TileLocation
+
+	// Source is data of the format the triangle was read from that the
+	// engine doesn't use. Encoders use it to write the triangle back the
+	// way it was read.
+	Source interface{}
+}
+
+// TileLocation is the position of a terrain tile. Level is 0 for the ground
+// and 1 for the upper level (bridges, rooftops, etc).
+type TileLocation struct {
+	X, Z, Level int
 }
 
 // Normal calculates and returns the face normal for the triangle.
@@ -39,15 +65,23 @@ func (t Triangle) Normal() Vec3 {
 	return normal
 }
 
-// FIXME: This is a clunky check. We should have triangle.Texcoords be nil
-// instead of this. But the fft importer currently returns 3 empty texcoords
-// regardless of whats in them. You cant just return nil until we add additional
-// checks into the clipping functionality because it indexes texcoords.
-func (t Triangle) HasTexture() bool {
-	for _, tc := range t.Texcoords {
-		if !tc.IsEmpty() {
-			return true
-		}
+// IsSemiTransparent reports whether the triangle needs to be drawn back to
+// front after the opaque triangles.
+func (t Triangle) IsSemiTransparent() bool {
+	return t.BlendMode != BlendModeOpaque
+}
+
+// Depth returns the average view space depth of the projected triangle. Larger
+// values are further from the camera.
+func (t Triangle) Depth() float64 {
+	var sum float64
+	for _, p := range t.Projected {
+		sum += p.W
 	}
-	return false
+	return sum / float64(len(t.Projected))
+}
+
+// HasTexture reports whether the triangle should be drawn with a texture.
+func (t Triangle) HasTexture() bool {
+	return t.Textured
 }
@@ -104,7 +104,8 @@ func NewMeshFromObj(objFilename string) Mesh {
 						vts[texture_indices[1]-1],
 						vts[texture_indices[2]-1],
 					},
-					Color: ColorWhite,
+					Textured: true,
+					Color:    ColorWhite,
 				})
 			}
 
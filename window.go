@@ -6,6 +6,14 @@ import (
 	"github.com/veandco/go-sdl2/sdl"
 )
 
+// Display shows the framebuffer once a frame has been rendered. Window shows
+// it on screen and Offscreen keeps it in memory.
+type Display interface {
+	Size() (width, height int)
+	Update(framebuffer *Framebuffer)
+	Destroy()
+}
+
 func NewWindow(width, height int) *Window {
 	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
 		panic(err)
@@ -56,6 +64,11 @@ type Window struct {
 	texture       *sdl.Texture
 }
 
+// Size returns the size of the window in pixels.
+func (w *Window) Size() (width, height int) {
+	return w.width, w.height
+}
+
 // Update takes a color buffer, updates the SDL Texture, copies the texture into
 // the SDL Renderer and then updates the screen.
 func (w *Window) Update(framebuffer *Framebuffer) {